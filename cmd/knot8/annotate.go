@@ -0,0 +1,231 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type AnnotateCmd struct {
+	CommonFlags
+	CommonSchemaFlags
+	SecretsFlags
+
+	Resource string   `name:"resource" help:"Resource (Kind/name or Kind/namespace/name) the pointers refer to. Can be omitted if there is only one resource."`
+	Fields   []string `arg:"" name:"field=pointer" help:"Field definitions."`
+	ToSchema bool     `name:"to-schema" help:"Write the field definitions to the schema file (Knot8file by default) instead of the resource annotations."`
+	Stdout   bool     `name:"stdout" help:"Output to stdout and never update files in-place"`
+	Diff     bool     `name:"diff" help:"Show a unified diff of the changes instead of writing them."`
+}
+
+func (s *AnnotateCmd) Run(ctx *Context) error {
+	manifestSet, err := openFields(s.Paths, existingSchema(s.Schema))
+	if err != nil && !isNotUniqueValueError(err) {
+		return err
+	}
+	manifestSet.showSecrets = s.ShowSecrets
+	m, err := findResource(manifestSet.Manifests, s.Resource)
+	if err != nil {
+		return err
+	}
+
+	defs, err := parseFieldDefs(s.Fields)
+	if err != nil {
+		return err
+	}
+	if err := checkFieldDefs(manifestSet.Fields, m, defs); err != nil {
+		return err
+	}
+
+	if !s.ToSchema {
+		if s.Stdout {
+			for _, m := range manifestSet.Manifests {
+				m.source.file.name = "-"
+			}
+		}
+		for _, d := range defs {
+			if err := setFieldAnno(m, d.Field, d.Value); err != nil {
+				return err
+			}
+		}
+		if s.Diff {
+			return manifestSet.Diff(os.Stdout)
+		}
+		return manifestSet.Commit()
+	}
+
+	path := s.Schema
+	if path == "" {
+		path = Knot8file
+	}
+	f, err := newShadowFile(path)
+	if os.IsNotExist(err) {
+		f, err = &shadowFile{name: path, dir: filepath.Dir(path)}, nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, d := range defs {
+		if err := addSchemaAnno(f, m, annoPrefix+d.Field, d.Value, ""); err != nil {
+			return err
+		}
+	}
+	switch {
+	case s.Diff:
+		fmt.Print(f.Diff())
+		return nil
+	case s.Stdout:
+		f.name = "-"
+	}
+	return f.Commit()
+}
+
+// existingSchema returns the path of the schema file, or an empty string if the file
+// doesn't exist yet and is going to be created.
+func existingSchema(path string) string {
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// findResource returns the manifest with the given short name (see FQN.Short).
+// If name is empty, the manifest set must contain exactly one manifest.
+func findResource(ms Manifests, name string) (*Manifest, error) {
+	if name == "" {
+		if len(ms) != 1 {
+			return nil, fmt.Errorf("found %d resources, use --resource to select one", len(ms))
+		}
+		return ms[0], nil
+	}
+	for _, m := range ms {
+		if m.FQN().Short() == name {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot find resource %q", name)
+}
+
+// parseFieldDefs parses field definitions in the form field=pointer.
+func parseFieldDefs(defs []string) ([]Setter, error) {
+	var res []Setter
+	for _, d := range defs {
+		c := strings.SplitN(d, "=", 2)
+		if len(c) != 2 || c[0] == "" || !strings.HasPrefix(c[1], "/") {
+			return nil, fmt.Errorf("bad field definition %q, expecting field=/pointer", d)
+		}
+		res = append(res, Setter{Field: c[0], Value: c[1]})
+	}
+	return res, nil
+}
+
+// checkFieldDefs checks that the pointers of the field definitions resolve in the manifest m
+// and that the resource doesn't define those fields already.
+// Pointers to values different from the current value of an existing field are reported as warnings.
+func checkFieldDefs(fields Fields, m *Manifest, defs []Setter) error {
+	seen := map[string]bool{}
+	var errs []error
+	for _, d := range defs {
+		if seen[d.Field] {
+			errs = append(errs, fmt.Errorf("field %q defined more than once", d.Field))
+			continue
+		}
+		seen[d.Field] = true
+		if p, ok := m.Metadata.Annotations[annoPrefix+d.Field]; ok {
+			errs = append(errs, fmt.Errorf("field %q already defined in %s as %q", d.Field, m.FQN().Short(), p))
+			continue
+		}
+		v, err := (Field{Name: d.Field, Pointers: []Pointer{{Expr: d.Value, Manifest: m}}}).GetAll()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("field %q: pointer %q doesn't resolve in %s: %w", d.Field, d.Value, m.FQN().Short(), err))
+			continue
+		}
+		if k, ok := fields[d.Field]; ok {
+			if cur, err := k.GetAll(); err == nil && len(cur) > 0 && cur[0].value != v[0].value {
+				fmt.Fprintf(os.Stderr, "warning: field %q has value %q but %s %s holds %q\n", d.Field, cur[0].value, m.FQN().Short(), d.Value, v[0].value)
+			}
+		}
+	}
+	if errs != nil {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// setFieldAnno adds the annotation defining the field n in the manifest m.
+func setFieldAnno(m *Manifest, n, ptr string) error {
+	f := m.source.file
+	b, err := setMapEntry(f.buf, m.source.streamPos, "/metadata/annotations", annoPrefix+n, ptr)
+	if err != nil {
+		return err
+	}
+	f.buf = b
+	if m.Metadata.Annotations == nil {
+		m.Metadata.Annotations = map[string]string{}
+	}
+	m.Metadata.Annotations[annoPrefix+n] = ptr
+	return nil
+}
+
+// addSchemaAnno adds an annotation, described by an optional comment, to the document of the
+// schema file f describing the manifest m. The document is appended to the schema if missing.
+func addSchemaAnno(f *shadowFile, m *Manifest, key, value, comment string) error {
+	schema, err := parseManifests(f)
+	if err != nil {
+		return err
+	}
+	for _, s := range schema {
+		if s.FQN() != m.FQN() {
+			continue
+		}
+		if v, ok := s.Metadata.Annotations[key]; ok && v != value {
+			return fmt.Errorf("annotation %q already defined in %s for %s as %q", key, f.name, m.FQN().Short(), v)
+		} else if ok {
+			return nil
+		}
+		b, err := setMapEntry(f.buf, s.source.streamPos, "/metadata/annotations", key, value)
+		if err != nil {
+			return err
+		}
+		f.buf = b
+		return setSchemaComment(f, s.source.streamPos, key, comment)
+	}
+
+	var b strings.Builder
+	b.Write(f.buf)
+	if len(f.buf) > 0 && !strings.HasSuffix(string(f.buf), "\n") {
+		b.WriteString("\n")
+	}
+	if hasContent(f.buf) {
+		b.WriteString("---\n")
+	}
+	fmt.Fprintf(&b, "apiVersion: %s\nkind: %s\nmetadata:\n", renderScalar(m.APIVersion, 0), renderScalar(m.Kind, 0))
+	if ns := m.Metadata.Namespace; ns != "" {
+		fmt.Fprintf(&b, "  namespace: %s\n", renderScalar(ns, 0))
+	}
+	fmt.Fprintf(&b, "  name: %s\n  annotations:\n", renderScalar(m.Metadata.Name, 0))
+	b.WriteString(renderEntry([]string{key}, value, 4))
+	f.buf = []byte(b.String())
+	docs, err := parseYAMLDocs(f.buf)
+	if err != nil {
+		return err
+	}
+	return setSchemaComment(f, len(docs)-1, key, comment)
+}
+
+func setSchemaComment(f *shadowFile, pos int, key, comment string) error {
+	if comment == "" {
+		return nil
+	}
+	b, err := setLineComment(f.buf, pos, "/metadata/annotations", key, comment)
+	if err != nil {
+		return err
+	}
+	f.buf = b
+	return nil
+}
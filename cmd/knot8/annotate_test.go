@@ -0,0 +1,140 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+const annotateTestSrc = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/name: /metadata/name
+spec:
+  replicas: 1
+`
+
+func TestAnnotate(t *testing.T) {
+	testCases := []struct {
+		defs []string
+		err  string
+		want string
+	}{
+		{
+			defs: []string{"replicas=/spec/replicas"},
+			want: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/name: /metadata/name
+    field.knot8.io/replicas: /spec/replicas
+spec:
+  replicas: 1
+`,
+		},
+		{defs: []string{"replicas"}, err: `bad field definition "replicas", expecting field=/pointer`},
+		{defs: []string{"name=/spec/replicas"}, err: `field "name" already defined in Deployment/demo as "/metadata/name"`},
+		{defs: []string{"a=/spec/replicas", "a=/metadata/name"}, err: `field "a" defined more than once`},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			ms := parseTestManifestSet(t, annotateTestSrc)
+			m := ms.Manifests[0]
+			defs, err := parseFieldDefs(tc.defs)
+			if err == nil {
+				err = checkFieldDefs(ms.Fields, m, defs)
+			}
+			if err != nil {
+				if got, want := err.Error(), tc.err; got != want {
+					t.Errorf("got: %q, want: %q", got, want)
+				}
+				return
+			}
+			for _, d := range defs {
+				if err := setFieldAnno(m, d.Field, d.Value); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got, want := string(m.source.file.buf), tc.want; got != want {
+				t.Errorf("got: %q, want: %q", got, want)
+			}
+		})
+	}
+
+	ms := parseTestManifestSet(t, annotateTestSrc)
+	if err := checkFieldDefs(ms.Fields, ms.Manifests[0], []Setter{{"a", "/spec/nope"}}); err == nil {
+		t.Errorf("expecting error for unresolved pointer")
+	}
+}
+
+func TestAddSchemaAnno(t *testing.T) {
+	ms := parseTestManifestSet(t, annotateTestSrc)
+	m := ms.Manifests[0]
+
+	f := &shadowFile{name: "Knot8file"}
+	if err := addSchemaAnno(f, m, annoPrefix+"replicas", "/spec/replicas", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := addSchemaAnno(f, m, annoPrefix+"other", "/metadata/name", ""); err != nil {
+		t.Fatal(err)
+	}
+	want := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/replicas: /spec/replicas
+    field.knot8.io/other: /metadata/name
+`
+	if got := string(f.buf); got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	if err := addSchemaAnno(f, m, annoPrefix+"replicas", "/spec/other", ""); err == nil {
+		t.Errorf("expecting error for conflicting definition")
+	}
+}
+
+func TestAnnotateDisabled(t *testing.T) {
+	path := copyTestdata(t, "cond1.yaml")
+	ms, err := openFields([]string{path}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := ms.NewEditBatch()
+	if err := b.Set("monitoring.enabled", "false"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := &AnnotateCmd{
+		CommonFlags: CommonFlags{Paths: []string{path}},
+		Resource:    "ConfigMap/demo",
+		Fields:      []string{"name=/metadata/name"},
+	}
+	if err := cmd.Run(&Context{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), annoPrefix+"name: /metadata/name") {
+		t.Errorf("missing field definition in:\n%s", got)
+	}
+	if !strings.Contains(string(got), disabledPrefix+"kind: ServiceMonitor") {
+		t.Errorf("disabled resource got enabled:\n%s", got)
+	}
+}
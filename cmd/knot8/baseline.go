@@ -0,0 +1,155 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The knot8.io/original annotation holds either the YAML body of the original values,
+// or a reference to it in one of the following forms:
+//
+//	gzip:<base64 of the gzip compressed body>
+//	file:<path of a sidecar file holding the body, relative to the manifest file>
+const (
+	gzipBaselinePrefix = "gzip:"
+	fileBaselinePrefix = "file:"
+
+	sidecarSuffix = ".knot8-original"
+
+	// annotationsSizeLimit is the maximum total size of the annotations of a Kubernetes resource.
+	annotationsSizeLimit = 256 << 10
+)
+
+// Baseline storage forms (see freeze).
+const (
+	baselineInline = "inline"
+	baselineGzip   = "gzip"
+	baselineFile   = "file"
+)
+
+// baselineForm returns the storage form of a knot8.io/original annotation value.
+func baselineForm(anno string) string {
+	isRef := func(prefix string) bool {
+		return strings.HasPrefix(anno, prefix) && !strings.ContainsAny(anno, " \n")
+	}
+	switch {
+	case isRef(gzipBaselinePrefix):
+		return baselineGzip
+	case isRef(fileBaselinePrefix):
+		return baselineFile
+	default:
+		return baselineInline
+	}
+}
+
+// decodeOriginalAnno returns the YAML body of the original values held by the
+// knot8.io/original annotation of the manifest m.
+func (ms *ManifestSet) decodeOriginalAnno(m *Manifest) (string, error) {
+	anno := m.Metadata.Annotations[originalAnno]
+	switch baselineForm(anno) {
+	case baselineGzip:
+		b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(anno, gzipBaselinePrefix))
+		if err != nil {
+			return "", fmt.Errorf("decoding %s of %s: %w", originalAnno, m.FQN().Short(), err)
+		}
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return "", fmt.Errorf("decoding %s of %s: %w", originalAnno, m.FQN().Short(), err)
+		}
+		body, err := io.ReadAll(r)
+		if err != nil {
+			return "", fmt.Errorf("decoding %s of %s: %w", originalAnno, m.FQN().Short(), err)
+		}
+		return string(body), nil
+	case baselineFile:
+		path := sidecarPath(m.source.file, strings.TrimPrefix(anno, fileBaselinePrefix))
+		for _, s := range ms.sidecars {
+			if s.name == path {
+				return string(s.buf), nil
+			}
+		}
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading %s of %s: %w", originalAnno, m.FQN().Short(), err)
+		}
+		return string(body), nil
+	default:
+		return anno, nil
+	}
+}
+
+// encodeOriginalAnno returns the value of the knot8.io/original annotation of the manifest m
+// holding the original values body in the given form.
+// For the "file" form, the sidecar file is scheduled to be written along with the manifests.
+func (ms *ManifestSet) encodeOriginalAnno(m *Manifest, body []byte, form string) (string, error) {
+	switch form {
+	case baselineGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return "", err
+		}
+		if err := w.Close(); err != nil {
+			return "", err
+		}
+		return gzipBaselinePrefix + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+	case baselineFile:
+		f := m.source.file
+		if f.name == "-" {
+			return "", fmt.Errorf("cannot store the original values of %s in a sidecar file when writing to stdout", m.FQN().Short())
+		}
+		rel := filepath.Base(f.name) + sidecarSuffix
+		if anno := m.Metadata.Annotations[originalAnno]; baselineForm(anno) == baselineFile {
+			rel = strings.TrimPrefix(anno, fileBaselinePrefix)
+		}
+		path := sidecarPath(f, rel)
+		ms.addSidecar(path, body)
+		return fileBaselinePrefix + rel, nil
+	default:
+		return string(body), nil
+	}
+}
+
+func sidecarPath(f *shadowFile, rel string) string {
+	if filepath.IsAbs(rel) {
+		return rel
+	}
+	return filepath.Join(f.dir, rel)
+}
+
+func (ms *ManifestSet) addSidecar(path string, body []byte) {
+	for _, s := range ms.sidecars {
+		if s.name == path {
+			s.buf = body
+			return
+		}
+	}
+	s := &shadowFile{name: path, buf: body}
+	if b, err := os.ReadFile(path); err == nil {
+		s.orig = b
+	}
+	ms.sidecars = append(ms.sidecars, s)
+}
+
+// annotationsSize returns the total size of the annotations of a manifest as found in its file,
+// including the annotations not used by knot8, as computed by Kubernetes.
+func annotationsSize(m *Manifest) (int, error) {
+	annos, err := rawAnnotations(m)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for k, v := range annos {
+		n += len(k) + len(v)
+	}
+	return n, nil
+}
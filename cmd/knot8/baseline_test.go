@@ -0,0 +1,85 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBaselineForms(t *testing.T) {
+	src := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/a: /data/a
+data:
+  a: "1"
+`
+	ms := parseTestManifestSet(t, src)
+	m := ms.Manifests[0]
+	m.source.file.dir = t.TempDir()
+	body := "a: \"1\"\n"
+
+	for _, form := range []string{baselineInline, baselineGzip, baselineFile} {
+		anno, err := ms.encodeOriginalAnno(m, []byte(body), form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := baselineForm(anno); got != form {
+			t.Errorf("got: %q, want: %q", got, form)
+		}
+		m.Metadata.Annotations[originalAnno] = anno
+		got, err := ms.decodeOriginalAnno(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != body {
+			t.Errorf("%s: got: %q, want: %q", form, got, body)
+		}
+	}
+
+	if got, want := ms.sidecars[0].name, filepath.Join(m.source.file.dir, "test.yaml.knot8-original"); got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	// a plain body can start with one of the prefixes.
+	if got := baselineForm("file: foo\n"); got != baselineInline {
+		t.Errorf("got: %q, want: %q", got, baselineInline)
+	}
+}
+
+func TestAnnotationsSize(t *testing.T) {
+	const lastApplied = "kubectl.kubernetes.io/last-applied-configuration"
+	big := strings.Repeat("x", 250<<10)
+	ms := parseTestManifestSet(t, fmt.Sprintf(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/a: /data/a
+    %s: %s
+data:
+  a: "1"
+`, lastApplied, big))
+
+	got, err := annotationsSize(ms.Manifests[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := len("field.knot8.io/a") + len("/data/a") + len(lastApplied) + len(big); got != want {
+		t.Errorf("got: %d, want: %d", got, want)
+	}
+
+	findings, err := lintAnnotationsSize(&lintContext{ms: ms})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(findings), 1; got != want {
+		t.Errorf("got: %d, want: %d", got, want)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+type CheckCmd struct {
+	CommonFlags
+	CommonSchemaFlags
+	SecretsFlags
+
+	Values []Setter `optional:"" arg:"" help:"Expected value. Format: field=value or field=@filename, where a leading @ can be escaped with a backslash."`
+	From   []string `name:"from" type:"file" help:"Read the expected values from one or more files."`
+}
+
+// A drift is a value pointed by a field that differs from the value it should have.
+type drift struct {
+	Field string
+	Ptr   Pointer
+	Got   string
+	Want  string
+}
+
+func (s *CheckCmd) Run(ctx *Context) error {
+	// like set, use the Knot8file as a source of default values.
+	if _, err := os.Stat(Knot8file); err == nil {
+		s.From = append([]string{Knot8file}, s.From...)
+	}
+
+	manifestSet, err := openFields(s.Paths, s.Schema)
+	if err != nil && !isNotUniqueValueError(err) {
+		return err
+	}
+
+	values, err := settersFromFiles(s.From)
+	if err != nil {
+		return err
+	}
+	values = append(values, s.Values...)
+	for i, v := range values {
+		values[i].Field = canonicalName(manifestSet.Fields, v.Field)
+	}
+
+	drifts, err := checkDrift(manifestSet.Fields, values)
+	if err != nil {
+		return err
+	}
+	renderDrifts(os.Stdout, manifestSet.Fields, drifts, s.ShowSecrets)
+	if len(drifts) > 0 {
+		return errors.New("some values differ from the expected values")
+	}
+	return nil
+}
+
+// checkDrift returns the values pointed by the fields that differ from the expected values.
+// Later setters override earlier setters of the same field.
+func checkDrift(fields Fields, values []Setter) ([]drift, error) {
+	want := map[string]string{}
+	for _, v := range values {
+		k, err := fields.lookup(v.Field)
+		if err != nil {
+			return nil, err
+		}
+		want[k.Name] = v.Value
+	}
+	var names []string
+	for n := range want {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var res []drift
+	for _, n := range names {
+		targets, err := fields[n].GetAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range targets {
+			if t.value != want[n] {
+				res = append(res, drift{Field: n, Ptr: t.ptr, Got: t.value, Want: want[n]})
+			}
+		}
+	}
+	return res, nil
+}
+
+func renderDrifts(w io.Writer, fields Fields, drifts []drift, showSecrets bool) {
+	for _, d := range drifts {
+		file, line, col := d.Ptr.Position()
+		fmt.Fprintf(w, "%s:%d:%d: field %q (%s): got %q, want %q\n", file, line, col, d.Field, d.Ptr,
+			fields.redact(d.Field, d.Got, showSecrets), fields.redact(d.Field, d.Want, showSecrets))
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckDrift(t *testing.T) {
+	ms := parseTestManifestSet(t, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/a: /data/a
+    field.knot8.io/b: /data/b
+    field.knot8.io/c: /data/c
+data:
+  a: "1"
+  b: "1"
+  c: "1"
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/b: /stringData/b
+stringData:
+  b: "2"
+`)
+
+	drifts, err := checkDrift(ms.Fields, []Setter{{"a", "2"}, {"b", "1"}, {"c", "1"}, {"a", "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	renderDrifts(&b, ms.Fields, drifts, false)
+	want := `test.yaml:21:6: field "b" (Secret/demo /stringData/b): got "<redacted>", want "<redacted>"` + "\n"
+	if got := b.String(); got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	if _, err := checkDrift(ms.Fields, []Setter{{"bogus", "1"}}); err == nil {
+		t.Errorf("expecting error for unknown field")
+	}
+}
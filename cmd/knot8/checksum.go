@@ -0,0 +1,151 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	yptr "github.com/vmware-labs/yaml-jsonpointer"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// dependsOnAnno declares the resources the pods of a workload depend upon,
+	// as a comma separated list of Kind/name pairs in the same namespace as the workload.
+	dependsOnAnno = "knot8.io/depends-on"
+
+	// checksumAnno is the pod template annotation holding the checksum of the
+	// resources declared in dependsOnAnno. Changing it causes the pods to roll.
+	checksumAnno = "knot8.io/checksum"
+)
+
+// updateChecksums updates the checksum annotation in the pod template of each workload that
+// declares dependencies on other resources whose content changed.
+// Workloads without a checksum annotation get one only once their dependencies change.
+func (ms *ManifestSet) updateChecksums() error {
+	docs := map[*shadowFile][]*yaml.Node{}
+	parsed := func(m *Manifest) (*yaml.Node, error) {
+		f := m.source.file
+		if _, ok := docs[f]; !ok {
+			d, err := parseYAMLDocs(f.buf)
+			if err != nil {
+				return nil, err
+			}
+			docs[f] = d
+		}
+		return docs[f][m.source.streamPos], nil
+	}
+	original := func(m *Manifest) (*yaml.Node, error) { return &m.raw, nil }
+
+	var errs []error
+	for _, m := range ms.Manifests {
+		if _, ok := m.Metadata.Annotations[dependsOnAnno]; !ok {
+			continue
+		}
+		path, ok := podTemplateMetadataPaths[m.Kind]
+		if !ok {
+			errs = append(errs, fmt.Errorf("resource %s: %s is not supported for kind %q", m.FQN(), dependsOnAnno, m.Kind))
+			continue
+		}
+
+		sum, err := ms.dependenciesChecksum(m, parsed)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resource %s: %w", m.FQN(), err))
+			continue
+		}
+		n, err := parsed(m)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var meta struct {
+			Annotations map[string]string `yaml:"annotations"`
+		}
+		if err := yamlDecodePath(n, "/"+path, &meta); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		cur, found := meta.Annotations[checksumAnno]
+		if cur == sum {
+			continue
+		}
+		if !found {
+			if orig, err := ms.dependenciesChecksum(m, original); err == nil && orig == sum {
+				continue
+			}
+		}
+
+		f := m.source.file
+		b, err := setMapEntry(f.buf, m.source.streamPos, "/"+path+"/annotations", checksumAnno, sum)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		f.buf = b
+		delete(docs, f)
+	}
+	if errs != nil {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// dependenciesChecksum returns the checksum of the resources the workload m depends upon,
+// as returned by doc.
+func (ms *ManifestSet) dependenciesChecksum(m *Manifest, doc func(*Manifest) (*yaml.Node, error)) (string, error) {
+	h := sha256.New()
+	for _, d := range strings.Split(m.Metadata.Annotations[dependsOnAnno], ",") {
+		dep, err := ms.Manifests.lookup(strings.TrimSpace(d), m.Metadata.Namespace)
+		if err != nil {
+			return "", err
+		}
+		n, err := doc(dep)
+		if err != nil {
+			return "", err
+		}
+		b, err := contentDigest(n)
+		if err != nil {
+			return "", err
+		}
+		h.Write(b)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// lookup finds a manifest by a "Kind/name" reference, in a given namespace.
+func (ms Manifests) lookup(ref, namespace string) (*Manifest, error) {
+	c := strings.SplitN(ref, "/", 2)
+	if len(c) != 2 {
+		return nil, fmt.Errorf("bad resource reference %q, expected Kind/name", ref)
+	}
+	for _, m := range ms {
+		if strings.EqualFold(m.Kind, c[0]) && m.Metadata.Name == c[1] && m.Metadata.Namespace == namespace {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot find resource %q", ref)
+}
+
+// contentDigest returns a canonical serialization of a resource, excluding its metadata.
+func contentDigest(doc *yaml.Node) ([]byte, error) {
+	var v map[string]interface{}
+	if err := doc.Decode(&v); err != nil {
+		return nil, err
+	}
+	delete(v, "metadata")
+	return json.Marshal(v)
+}
+
+// yamlDecodePath decodes the node pointed by ptr, if it exists.
+func yamlDecodePath(doc *yaml.Node, ptr string, v interface{}) error {
+	n, err := yptr.Find(doc, ptr)
+	if err != nil {
+		return nil
+	}
+	return n.Decode(v)
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	yptr "github.com/vmware-labs/yaml-jsonpointer"
+)
+
+func TestUpdateChecksums(t *testing.T) {
+	const anno = "/spec/template/metadata/annotations/knot8.io~1checksum"
+
+	testCases := []struct {
+		values []string // values of foo, each followed by updateChecksums
+		want   bool     // whether the checksum annotation is present
+	}{
+		{nil, false},
+		{[]string{"bar"}, false},
+		{[]string{"baz"}, true},
+		{[]string{"baz", "bar"}, true},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			ms, err := openFields([]string{copyTestdata(t, "checksum1.yaml")}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := ms.Manifests[0].source.file
+
+			update := func() {
+				t.Helper()
+				if err := ms.updateChecksums(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			update()
+			for _, v := range tc.values {
+				b := ms.NewEditBatch()
+				if err := b.Set("foo", v); err != nil {
+					t.Fatal(err)
+				}
+				if err := b.Commit(); err != nil {
+					t.Fatal(err)
+				}
+				update()
+			}
+
+			docs, err := parseYAMLDocs(f.buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = yptr.Find(docs[0], anno)
+			if got, want := err == nil, tc.want; got != want {
+				t.Errorf("got: %v, want: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestUpdateChecksumsErrors(t *testing.T) {
+	ms := parseTestManifestSet(t, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: a
+  annotations:
+    knot8.io/depends-on: ConfigMap/missing
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: b
+  annotations:
+    knot8.io/depends-on: ConfigMap/missing
+`)
+	err := ms.updateChecksums()
+	if err == nil {
+		t.Fatal("expecting error")
+	}
+	if got, want := len(err.(interface{ Unwrap() []error }).Unwrap()), 2; got != want {
+		t.Errorf("got: %d, want: %d (%v)", got, want, err)
+	}
+}
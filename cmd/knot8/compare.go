@@ -0,0 +1,193 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+type CompareCmd struct {
+	CommonSchemaFlags
+	SecretsFlags
+
+	Old      string `arg:"" help:"Manifests of the old version (file or directory)."`
+	New      string `arg:"" help:"Manifests of the new version (file or directory)."`
+	Breaking bool   `name:"breaking" help:"Fail if fields have been removed or point to different resources."`
+}
+
+// A fieldChange describes how a field changed between two versions.
+type fieldChange struct {
+	Name string
+	// Kind is one of "added", "removed", "renamed", "pointers" or "default".
+	Kind string
+	Old  []string
+	New  []string
+	// Breaking changes break the values files or the customizations written against the old version.
+	Breaking bool
+}
+
+func (s *CompareCmd) Run(ctx *Context) error {
+	oldSet, err := openFields([]string{s.Old}, s.Schema)
+	if err != nil && !isNotUniqueValueError(err) {
+		return err
+	}
+	newSet, err := openFields([]string{s.New}, s.Schema)
+	if err != nil && !isNotUniqueValueError(err) {
+		return err
+	}
+
+	changes, err := compareFields(oldSet, newSet, s.ShowSecrets)
+	if err != nil {
+		return err
+	}
+	renderChanges(os.Stdout, changes)
+
+	if s.Breaking {
+		var breaking []string
+		for _, c := range changes {
+			if c.Breaking {
+				breaking = append(breaking, c.Name)
+			}
+		}
+		if len(breaking) > 0 {
+			return fmt.Errorf("breaking changes in fields %q", breaking)
+		}
+	}
+	return nil
+}
+
+// compareFields returns the changes in the fields and in their default values between two versions.
+// The default value of a field is its original value, if known, or its current value.
+func compareFields(oldSet, newSet *ManifestSet, showSecrets bool) ([]fieldChange, error) {
+	oldDefaults, err := defaultValues(oldSet)
+	if err != nil {
+		return nil, err
+	}
+	newDefaults, err := defaultValues(newSet)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []fieldChange
+	for _, n := range newSet.Fields.Names() {
+		if _, ok := oldSet.Fields[n]; ok {
+			continue
+		}
+		renamed := false
+		for _, a := range newSet.Fields[n].Aliases {
+			_, found := oldSet.Fields[a]
+			renamed = renamed || found
+		}
+		if !renamed {
+			res = append(res, fieldChange{Name: n, Kind: "added", New: pointerStrings(newSet.Fields[n])})
+		}
+	}
+
+	for _, on := range oldSet.Fields.Names() {
+		ok := oldSet.Fields[on]
+		n, _ := newSet.Fields.canonical(on)
+		nk, found := newSet.Fields[n]
+		if !found {
+			res = append(res, fieldChange{Name: on, Kind: "removed", Old: pointerStrings(ok), Breaking: true})
+			continue
+		}
+		if n != on {
+			res = append(res, fieldChange{Name: on, Kind: "renamed", New: []string{n}})
+		}
+
+		op, np := pointerStrings(ok), pointerStrings(nk)
+		if strings.Join(op, "\n") != strings.Join(np, "\n") {
+			res = append(res, fieldChange{Name: n, Kind: "pointers", Old: op, New: np, Breaking: !sameResources(ok, nk)})
+		}
+
+		if ov, nv := oldDefaults[on], newDefaults[n]; ov != nv {
+			res = append(res, fieldChange{
+				Name: n,
+				Kind: "default",
+				Old:  []string{oldSet.Fields.redact(on, ov, showSecrets)},
+				New:  []string{newSet.Fields.redact(n, nv, showSecrets)},
+			})
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+func defaultValues(ms *ManifestSet) (map[string]string, error) {
+	res, err := findOriginal(ms)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range ms.Fields.Names() {
+		if _, ok := res[n]; ok {
+			continue
+		}
+		values, err := ms.Fields.GetAll(n)
+		if err != nil {
+			return nil, err
+		}
+		res[n] = values[0].value
+	}
+	return res, nil
+}
+
+func pointerStrings(k Field) []string {
+	var res []string
+	for _, p := range k.Pointers {
+		res = append(res, p.String())
+	}
+	sort.Strings(res)
+	return res
+}
+
+// sameResources returns true if both fields point to the same set of resources.
+func sameResources(a, b Field) bool {
+	set := func(k Field) string {
+		m := map[string]bool{}
+		for _, p := range k.Pointers {
+			m[p.Manifest.FQN().String()] = true
+		}
+		var l []string
+		for r := range m {
+			l = append(l, r)
+		}
+		sort.Strings(l)
+		return strings.Join(l, "\n")
+	}
+	return set(a) == set(b)
+}
+
+func renderChanges(w io.Writer, changes []fieldChange) {
+	for _, c := range changes {
+		mark := ""
+		if c.Breaking {
+			mark = " (breaking)"
+		}
+		switch c.Kind {
+		case "added":
+			fmt.Fprintf(w, "added field %q%s\n", c.Name, mark)
+		case "removed":
+			fmt.Fprintf(w, "removed field %q%s\n", c.Name, mark)
+		case "renamed":
+			fmt.Fprintf(w, "renamed field %q to %q%s\n", c.Name, c.New[0], mark)
+			continue
+		case "pointers":
+			fmt.Fprintf(w, "changed pointers of field %q%s\n", c.Name, mark)
+		case "default":
+			fmt.Fprintf(w, "changed default of field %q from %q to %q%s\n", c.Name, c.Old[0], c.New[0], mark)
+			continue
+		}
+		for _, p := range c.Old {
+			fmt.Fprintf(w, "  - %s\n", p)
+		}
+		for _, p := range c.New {
+			fmt.Fprintf(w, "  + %s\n", p)
+		}
+	}
+}
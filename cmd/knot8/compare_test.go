@@ -0,0 +1,67 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareFields(t *testing.T) {
+	oldSet := parseTestManifestSet(t, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/a: /data/a
+    field.knot8.io/b: /data/b
+    field.knot8.io/c: /data/c
+    field.knot8.io/d: /data/d
+data:
+  a: "1"
+  b: "1"
+  c: "1"
+  d: "1"
+`)
+	newSet := parseTestManifestSet(t, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/a: /data/a
+    field.knot8.io/b2: /data/b
+    deprecated.knot8.io/b: b2
+    field.knot8.io/d: /data/d
+    field.knot8.io/e: /data/e
+data:
+  a: "2"
+  b: "1"
+  d: "1"
+  e: "1"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other
+  annotations:
+    field.knot8.io/d: /data/d
+data:
+  d: "1"
+`)
+
+	got, err := compareFields(oldSet, newSet, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []fieldChange{
+		{Name: "a", Kind: "default", Old: []string{"1"}, New: []string{"2"}},
+		{Name: "b", Kind: "renamed", New: []string{"b2"}},
+		{Name: "c", Kind: "removed", Old: []string{"ConfigMap/demo /data/c"}, Breaking: true},
+		{Name: "d", Kind: "pointers", Old: []string{"ConfigMap/demo /data/d"}, New: []string{"ConfigMap/demo /data/d", "ConfigMap/other /data/d"}, Breaking: true},
+		{Name: "e", Kind: "added", New: []string{"ConfigMap/demo /data/e"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
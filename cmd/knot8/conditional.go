@@ -0,0 +1,162 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+const (
+	// enabledByAnno binds the inclusion of a resource to the value of a boolean field.
+	enabledByAnno = "knot8.io/enabled-by"
+
+	// disabledPrefix is prepended to each line of a resource that has been disabled in-place.
+	disabledPrefix = "#knot8:disabled# "
+)
+
+// A yamlDoc is the span of a document inside a YAML stream, in byte offsets.
+// The span includes the leading document separator, if any.
+type yamlDoc struct {
+	start, end int
+}
+
+// splitYAMLDocs splits a YAML stream into documents.
+// The returned slice is indexed by the same stream position used by the YAML decoder,
+// i.e. comments and blank lines preceding the first document separator are not a document
+// of their own, while anything following a separator is (even if it contains only comments).
+func splitYAMLDocs(buf []byte) []yamlDoc {
+	var (
+		res   []yamlDoc
+		start int
+	)
+	for pos := 0; pos < len(buf); {
+		line := buf[pos:]
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i+1]
+		}
+		if pos > start && isDocSeparator(line) {
+			res = append(res, yamlDoc{start, pos})
+			start = pos
+		}
+		pos += len(line)
+	}
+	res = append(res, yamlDoc{start, len(buf)})
+
+	if !hasContent(buf[res[0].start:res[0].end]) {
+		res = res[1:]
+	}
+	return res
+}
+
+func isDocSeparator(line []byte) bool {
+	line = bytes.TrimRight(line, "\r\n")
+	return bytes.Equal(line, []byte("---")) || bytes.HasPrefix(line, []byte("--- ")) || bytes.HasPrefix(line, []byte("---\t"))
+}
+
+// hasContent returns true if a chunk of a YAML stream contains anything other than
+// separators, comments and blank lines.
+func hasContent(chunk []byte) bool {
+	for _, l := range bytes.Split(chunk, []byte("\n")) {
+		l = bytes.TrimSpace(l)
+		if len(l) > 0 && l[0] != '#' && !isDocSeparator(l) {
+			return true
+		}
+	}
+	return false
+}
+
+// disableDocs removes the documents at the given stream positions.
+// If drop is false, the documents are commented out instead, so they
+// can be restored later by enableDocs.
+func disableDocs(buf []byte, positions []int, drop bool) []byte {
+	sel := map[int]bool{}
+	for _, p := range positions {
+		sel[p] = true
+	}
+
+	var (
+		res  []byte
+		last int
+	)
+	for i, d := range splitYAMLDocs(buf) {
+		if !sel[i] {
+			continue
+		}
+		res = append(res, buf[last:d.start]...)
+		if !drop {
+			res = append(res, commentOut(buf[d.start:d.end])...)
+		}
+		last = d.end
+	}
+	return append(res, buf[last:]...)
+}
+
+func commentOut(doc []byte) []byte {
+	var res []byte
+	for len(doc) > 0 {
+		line := doc
+		if i := bytes.IndexByte(doc, '\n'); i >= 0 {
+			line = doc[:i+1]
+		}
+		if !isDocSeparator(line) {
+			res = append(res, disabledPrefix...)
+		}
+		res = append(res, line...)
+		doc = doc[len(line):]
+	}
+	return res
+}
+
+// enableDocs restores all the documents previously commented out by disableDocs.
+func enableDocs(buf []byte) []byte {
+	prefix := []byte(disabledPrefix)
+	if !bytes.Contains(buf, prefix) {
+		return buf
+	}
+	lines := bytes.SplitAfter(buf, []byte("\n"))
+	for i, l := range lines {
+		lines[i] = bytes.TrimPrefix(l, prefix)
+	}
+	return bytes.Join(lines, nil)
+}
+
+// isEnabled evaluates the boolean field a conditional resource is bound to.
+func (ks Fields) isEnabled(n string) (bool, error) {
+	v, err := ks.GetValue(n)
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("field %q must be a boolean, found %q", n, v)
+	}
+	return b, nil
+}
+
+// applyConditions disables all the manifests whose knot8.io/enabled-by field evaluates to false.
+// Disabled manifests are omitted when rendering to standard output and commented out
+// when editing files in-place.
+func (ms *ManifestSet) applyConditions() error {
+	disabled := map[*shadowFile][]int{}
+	for _, m := range ms.Manifests {
+		n, ok := m.Metadata.Annotations[enabledByAnno]
+		if !ok {
+			continue
+		}
+		on, err := ms.Fields.isEnabled(n)
+		if err != nil {
+			return fmt.Errorf("resource %s: %w", m.FQN(), err)
+		}
+		if !on {
+			f := m.source.file
+			disabled[f] = append(disabled[f], m.source.streamPos)
+		}
+	}
+	for f, pos := range disabled {
+		f.buf = disableDocs(f.buf, pos, f.name == "-")
+	}
+	return nil
+}
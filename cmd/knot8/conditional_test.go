@@ -0,0 +1,213 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSplitYAMLDocs(t *testing.T) {
+	testCases := []string{
+		"a: 1\n",
+		"a: 1\n---\nb: 2\n",
+		"---\na: 1\n---\nb: 2\n",
+		"# head\n---\na: 1\n---\nb: 2",
+		"a: 1\n---\n# only a comment\n---\nb: 2\n",
+		"a: 1\n---\n",
+		"a: |\n  ---\n  x\n---\nb: 2\n",
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			dec := yaml.NewDecoder(bytes.NewReader([]byte(tc)))
+			n := 0
+			for ; ; n++ {
+				var node yaml.Node
+				if err := dec.Decode(&node); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got, want := len(splitYAMLDocs([]byte(tc))), n; got != want {
+				t.Errorf("got: %d, want: %d", got, want)
+			}
+		})
+	}
+}
+
+func TestDisableDocs(t *testing.T) {
+	src := "a: 1\n---\nb: 2\n---\nc: 3\n"
+	testCases := []struct {
+		pos  []int
+		drop bool
+		want string
+	}{
+		{[]int{1}, true, "a: 1\n---\nc: 3\n"},
+		{[]int{0}, true, "---\nb: 2\n---\nc: 3\n"},
+		{[]int{0, 2}, true, "---\nb: 2\n"},
+		{[]int{1}, false, "a: 1\n---\n" + disabledPrefix + "b: 2\n---\nc: 3\n"},
+		{[]int{0}, false, disabledPrefix + "a: 1\n---\nb: 2\n---\nc: 3\n"},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			got := disableDocs([]byte(src), tc.pos, tc.drop)
+			if got, want := string(got), tc.want; got != want {
+				t.Errorf("got: %q, want: %q", got, want)
+			}
+			if !tc.drop {
+				if got, want := string(enableDocs(got)), src; got != want {
+					t.Errorf("got: %q, want: %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIsEnabled(t *testing.T) {
+	testCases := []struct {
+		value string
+		want  bool
+		err   bool
+	}{
+		{"true", true, false},
+		{"false", false, false},
+		{"1", true, false},
+		{"yes", false, true},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			ms := parseTestManifestSet(t, fmt.Sprintf(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/on: /data/on
+data:
+  on: %q
+`, tc.value))
+			got, err := ms.Fields.isEnabled("on")
+			if (err != nil) != tc.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if want := tc.want; got != want {
+				t.Errorf("got: %v, want: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyConditions(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value string
+		want  []string // kinds of the enabled resources
+	}{
+		{"-", "true", []string{"ConfigMap", "ServiceMonitor"}},
+		{"-", "false", []string{"ConfigMap"}},
+		{"test.yaml", "false", []string{"ConfigMap"}},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			path := copyTestdata(t, "cond1.yaml")
+			ms, err := openFields([]string{path}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := ms.Manifests[0].source.file
+			f.name = tc.name
+
+			b := ms.NewEditBatch()
+			if err := b.Set("monitoring.enabled", tc.value); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if err := ms.applyConditions(); err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := parseManifests(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, m := range res {
+				got = append(got, m.Kind)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %q, want: %q", got, tc.want)
+			}
+			if got, want := bytes.Contains(f.buf, []byte(disabledPrefix)), tc.name != "-" && tc.value == "false"; got != want {
+				t.Errorf("got: %v, want: %v", got, want)
+			}
+		})
+	}
+}
+
+// TestConditionalRoundTrip disables a resource in-place and re-enables it, going through the files.
+func TestConditionalRoundTrip(t *testing.T) {
+	path := copyTestdata(t, "cond1.yaml")
+	orig, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := func(v string) {
+		t.Helper()
+		ms, err := openFields([]string{path}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := ms.NewEditBatch()
+		if err := b.Set("monitoring.enabled", v); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if err := ms.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	set("false")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Count(string(b), disabledPrefix+"kind: ServiceMonitor"), 1; got != want {
+		t.Fatalf("got: %d, want: %d\n%s", got, want, b)
+	}
+	ms, err := openFields([]string{path}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(ms.Manifests), 2; got != want {
+		t.Errorf("got: %d, want: %d", got, want)
+	}
+
+	set("true")
+	b, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the ServiceMonitor is restored verbatim.
+	want := string(orig[bytes.Index(orig, []byte("---")):])
+	if got := string(b); !strings.HasSuffix(got, want) {
+		t.Errorf("got: %q, want suffix: %q", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type DocsCmd struct {
+	CommonFlags
+	CommonSchemaFlags
+	SecretsFlags
+
+	Format string `name:"format" enum:"markdown,man" default:"markdown" help:"Output format (markdown, man)."`
+}
+
+// A fieldDoc holds the documentation of one field.
+type fieldDoc struct {
+	Name        string
+	Value       string
+	Original    string
+	Locations   []string
+	Description string
+}
+
+func (s *DocsCmd) Run(ctx *Context) error {
+	manifestSet, err := openFields(s.Paths, s.Schema)
+	if err != nil && !isNotUniqueValueError(err) {
+		return err
+	}
+	docs, err := fieldDocs(manifestSet, s.ShowSecrets)
+	if err != nil {
+		return err
+	}
+
+	switch s.Format {
+	case "man":
+		renderManDocs(os.Stdout, docs)
+	default:
+		renderMarkdownDocs(os.Stdout, docs)
+	}
+	return nil
+}
+
+func fieldDocs(ms *ManifestSet, showSecrets bool) ([]fieldDoc, error) {
+	o, err := findOriginal(ms)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []fieldDoc
+	for _, n := range ms.Fields.Names() {
+		k := ms.Fields[n]
+		values, err := k.GetAll()
+		if err != nil {
+			return nil, err
+		}
+		d := fieldDoc{
+			Name:        n,
+			Value:       ms.Fields.redact(n, values[0].value, showSecrets),
+			Description: k.Description,
+		}
+		if v, ok := o[n]; ok {
+			d.Original = ms.Fields.redact(n, v, showSecrets)
+		}
+		for _, p := range k.Pointers {
+			d.Locations = append(d.Locations, p.String())
+		}
+
+		var notes []string
+		if len(k.Aliases) > 0 {
+			notes = append(notes, fmt.Sprintf("Deprecated names: %s.", strings.Join(k.Aliases, ", ")))
+		}
+		if k.Immutable {
+			notes = append(notes, "Immutable.")
+		}
+		if k.Generator != "" {
+			notes = append(notes, fmt.Sprintf("Generated (%s).", k.Generator))
+		}
+		if len(notes) > 0 {
+			d.Description = strings.TrimSpace(d.Description + " " + strings.Join(notes, " "))
+		}
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+func renderMarkdownDocs(w io.Writer, docs []fieldDoc) {
+	cell := func(s string) string {
+		s = strings.ReplaceAll(s, "|", `\|`)
+		return strings.ReplaceAll(strings.TrimSuffix(s, "\n"), "\n", "<br>")
+	}
+	code := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return "`" + cell(s) + "`"
+	}
+
+	fmt.Fprintln(w, "| Field | Value | Original | Locations | Description |")
+	fmt.Fprintln(w, "|-------|-------|----------|-----------|-------------|")
+	for _, d := range docs {
+		var locs []string
+		for _, l := range d.Locations {
+			locs = append(locs, code(l))
+		}
+		fmt.Fprintf(w, "| %s | %s | %s | %s | %s |\n", code(d.Name), code(d.Value), code(d.Original), strings.Join(locs, "<br>"), cell(d.Description))
+	}
+}
+
+func renderManDocs(w io.Writer, docs []fieldDoc) {
+	text := func(s string) string {
+		// escape backslashes and lines starting with a control character.
+		s = strings.ReplaceAll(s, `\`, `\e`)
+		lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+		for i, l := range lines {
+			if strings.HasPrefix(l, ".") || strings.HasPrefix(l, "'") {
+				lines[i] = `\&` + l
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	fmt.Fprintln(w, ".Sh FIELDS")
+	fmt.Fprintln(w, ".Bl -tag -width Ds")
+	for _, d := range docs {
+		fmt.Fprintf(w, ".It Sy %s\n", text(d.Name))
+		if d.Description != "" {
+			fmt.Fprintln(w, text(d.Description))
+			fmt.Fprintln(w, ".Pp")
+		}
+		fmt.Fprintln(w, "Value:")
+		fmt.Fprintf(w, ".Ql %s\n", text(d.Value))
+		if d.Original != "" {
+			fmt.Fprintln(w, ".br")
+			fmt.Fprintln(w, "Original:")
+			fmt.Fprintf(w, ".Ql %s\n", text(d.Original))
+		}
+		fmt.Fprintln(w, ".br")
+		fmt.Fprintln(w, "Locations:")
+		fmt.Fprintln(w, ".Bl -dash -compact")
+		for _, l := range d.Locations {
+			fmt.Fprintf(w, ".It\n.Li %s\n", text(l))
+		}
+		fmt.Fprintln(w, ".El")
+	}
+	fmt.Fprintln(w, ".El")
+}
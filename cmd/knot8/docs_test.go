@@ -0,0 +1,26 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdownDocs(t *testing.T) {
+	docs := []fieldDoc{
+		{Name: "replicas", Value: "1", Original: "1", Locations: []string{"Deployment/demo /spec/replicas"}, Description: "Number of pods."},
+		{Name: "motd", Value: "a|b\nc\n", Locations: []string{"ConfigMap/demo /data/motd", "ConfigMap/other /data/motd"}},
+	}
+	var b strings.Builder
+	renderMarkdownDocs(&b, docs)
+
+	want := "| Field | Value | Original | Locations | Description |\n" +
+		"|-------|-------|----------|-----------|-------------|\n" +
+		"| `replicas` | `1` | `1` | `Deployment/demo /spec/replicas` | Number of pods. |\n" +
+		"| `motd` | `a\\|b<br>c` |  | `ConfigMap/demo /data/motd`<br>`ConfigMap/other /data/motd` |  |\n"
+	if got := b.String(); got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-openapi/jsonpointer"
+	yptr "github.com/vmware-labs/yaml-jsonpointer"
+	"gopkg.in/yaml.v3"
+	"knot8.io/pkg/lensed"
+)
+
+// parseYAMLDocs parses all the documents of a YAML stream.
+func parseYAMLDocs(buf []byte) ([]*yaml.Node, error) {
+	var res []*yaml.Node
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+	for {
+		var n yaml.Node
+		if err := dec.Decode(&n); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		res = append(res, &n)
+	}
+	return res, nil
+}
+
+// setMapEntry sets the value of a key in the mapping pointed by ptr, in the document
+// at stream position pos. The key is added if missing, along with any missing parent mapping.
+// The rest of the document is left untouched.
+func setMapEntry(buf []byte, pos int, ptr, key, value string) ([]byte, error) {
+	docs, err := parseYAMLDocs(buf)
+	if err != nil {
+		return nil, err
+	}
+	if pos >= len(docs) {
+		return nil, fmt.Errorf("cannot find document %d", pos)
+	}
+	doc := docs[pos]
+
+	if n, err := yptr.Find(doc, ptr+"/"+escapePointerToken(key)); err == nil && n.Kind == yaml.ScalarNode {
+		return lensed.Apply(buf, []lensed.Mapping{
+			{Pointer: fmt.Sprintf("~(yamls)/%d%s/%s", pos, ptr, escapePointerToken(key)), Replacement: value},
+		})
+	}
+
+	p, err := jsonpointer.New(ptr)
+	if err != nil {
+		return nil, err
+	}
+	toks := p.DecodedTokens()
+
+	// find the closest existing ancestor and create the missing mappings.
+	keys := []string{key}
+	for i := len(toks); i > 0; i-- {
+		parent := "/" + strings.Join(escapeTokens(toks[:i]), "/")
+		if n, err := yptr.Find(doc, parent); err == nil {
+			if n.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("%q is not a mapping", parent)
+			}
+			return insertMapEntry(buf, n, keys, value)
+		}
+		keys = append([]string{toks[i-1]}, keys...)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("document %d is not a mapping", pos)
+	}
+	return insertMapEntry(buf, doc.Content[0], keys, value)
+}
+
+// renameMapKey renames a key of the mapping pointed by ptr, in the document at stream position pos.
+// It returns false if the key is missing. The rest of the document is left untouched.
+func renameMapKey(buf []byte, pos int, ptr, key, newKey string) ([]byte, bool, error) {
+	m, i, err := findMapEntry(buf, pos, ptr, key)
+	if err != nil || i < 0 {
+		return buf, false, err
+	}
+	k := m.Content[i]
+	text := renderScalar(newKey, 0)
+	switch {
+	case k.Style&yaml.DoubleQuotedStyle != 0:
+		b, _ := json.Marshal(newKey)
+		text = string(b)
+	case k.Style&yaml.SingleQuotedStyle != 0:
+		text = "'" + strings.ReplaceAll(newKey, "'", "''") + "'"
+	}
+	src := []rune(string(buf))
+	res := string(src[:k.Index]) + text + string(src[k.IndexEnd:])
+	return []byte(res), true, nil
+}
+
+// findMapEntry returns the mapping pointed by ptr in the document at stream position pos,
+// and the index of the key in its content, or -1 if either is missing.
+func findMapEntry(buf []byte, pos int, ptr, key string) (*yaml.Node, int, error) {
+	docs, err := parseYAMLDocs(buf)
+	if err != nil {
+		return nil, -1, err
+	}
+	if pos >= len(docs) {
+		return nil, -1, fmt.Errorf("cannot find document %d", pos)
+	}
+	m := docs[pos]
+	if ptr != "" {
+		if m, err = yptr.Find(m, ptr); err != nil {
+			return nil, -1, nil
+		}
+	} else if len(m.Content) > 0 {
+		m = m.Content[0]
+	}
+	if m.Kind != yaml.MappingNode {
+		return nil, -1, nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if k := m.Content[i]; k.Kind == yaml.ScalarNode && k.Value == key {
+			return m, i, nil
+		}
+	}
+	return m, -1, nil
+}
+
+// deleteMapEntry removes a key, along with its value and comments, from the mapping pointed by ptr
+// in the document at stream position pos. If the mapping becomes empty, its own entry is removed
+// from the parent mapping. It returns false if the key is missing.
+func deleteMapEntry(buf []byte, pos int, ptr, key string) ([]byte, bool, error) {
+	m, i, err := findMapEntry(buf, pos, ptr, key)
+	if err != nil || i < 0 {
+		return buf, false, err
+	}
+	if len(m.Content) == 2 && ptr != "" {
+		p, err := jsonpointer.New(ptr)
+		if err != nil {
+			return nil, false, err
+		}
+		toks := p.DecodedTokens()
+		parent := ""
+		if len(toks) > 1 {
+			parent = "/" + strings.Join(escapeTokens(toks[:len(toks)-1]), "/")
+		}
+		if b, ok, err := deleteMapEntry(buf, pos, parent, toks[len(toks)-1]); ok || err != nil {
+			return b, ok, err
+		}
+	}
+
+	src := []rune(string(buf))
+	k, v := m.Content[i], m.Content[i+1]
+	var start, end int
+	if m.Style&yaml.FlowStyle != 0 {
+		start, end = k.Index, v.IndexEnd
+		if i+2 < len(m.Content) {
+			end = m.Content[i+2].Index
+		} else if i > 0 {
+			start = m.Content[i-1].IndexEnd
+		}
+	} else {
+		start, end = k.Index, endOfLine(src, lastLeaf(v))
+		line := start
+		for line > 0 && src[line-1] != '\n' {
+			line--
+		}
+		if strings.TrimSpace(string(src[line:start])) == "" {
+			start = line
+			// include the comment lines preceding the key.
+			for k.HeadComment != "" && start > 0 {
+				prev := start - 1
+				for prev > 0 && src[prev-1] != '\n' {
+					prev--
+				}
+				if !strings.HasPrefix(strings.TrimSpace(string(src[prev:start])), "#") {
+					break
+				}
+				start = prev
+			}
+		}
+	}
+	res := string(src[:start]) + string(src[end:])
+	return []byte(res), true, nil
+}
+
+// setLineComment adds a comment at the end of the line of the value of a key in the block mapping
+// pointed by ptr, in the document at stream position pos, unless the value has a comment already.
+func setLineComment(buf []byte, pos int, ptr, key, comment string) ([]byte, error) {
+	m, i, err := findMapEntry(buf, pos, ptr, key)
+	if err != nil || i < 0 || m.Style&yaml.FlowStyle != 0 {
+		return buf, err
+	}
+	k, v := m.Content[i], m.Content[i+1]
+	if v.Kind != yaml.ScalarNode || v.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 || k.HeadComment != "" || k.LineComment != "" || v.LineComment != "" {
+		return buf, nil
+	}
+	src := []rune(string(buf))
+	res := string(src[:v.IndexEnd]) + " # " + strings.ReplaceAll(comment, "\n", " ") + string(src[v.IndexEnd:])
+	return []byte(res), nil
+}
+
+func escapeTokens(toks []string) []string {
+	res := make([]string, len(toks))
+	for i, t := range toks {
+		res[i] = escapePointerToken(t)
+	}
+	return res
+}
+
+// insertMapEntry inserts an entry in a mapping node. The entry is a nested mapping
+// following the sequence of keys, ending in value.
+func insertMapEntry(buf []byte, m *yaml.Node, keys []string, value string) ([]byte, error) {
+	src := []rune(string(buf))
+
+	var (
+		at   int
+		text string
+	)
+	if m.Style&yaml.FlowStyle != 0 || len(m.Content) == 0 {
+		var entry interface{} = value
+		for i := len(keys) - 1; i >= 0; i-- {
+			entry = map[string]interface{}{keys[i]: entry}
+		}
+		j, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		body := strings.TrimSuffix(strings.TrimPrefix(string(j), "{"), "}")
+
+		// m.IndexEnd points right after the closing brace.
+		at = m.IndexEnd - 1
+		for at > m.Index && (at >= len(src) || src[at] != '}') {
+			at--
+		}
+		if len(m.Content) > 0 {
+			body = ", " + body
+		}
+		text = body
+	} else {
+		indent := m.Content[0].Column - 1
+		at = endOfLine(src, lastLeaf(m))
+		if at > 0 && src[at-1] != '\n' {
+			text = "\n"
+		}
+		text += renderEntry(keys, value, indent)
+	}
+
+	res := string(src[:at]) + text + string(src[at:])
+	return []byte(res), nil
+}
+
+// lastLeaf returns the last node (in document order) inside a block collection.
+func lastLeaf(n *yaml.Node) *yaml.Node {
+	for (n.Kind == yaml.MappingNode || n.Kind == yaml.SequenceNode) && n.Style&yaml.FlowStyle == 0 && len(n.Content) > 0 {
+		n = n.Content[len(n.Content)-1]
+	}
+	return n
+}
+
+// endOfLine returns the offset of the beginning of the line following the node n.
+func endOfLine(src []rune, n *yaml.Node) int {
+	i := n.IndexEnd
+	if n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		i--
+	}
+	for ; i < len(src); i++ {
+		if src[i] == '\n' {
+			return i + 1
+		}
+	}
+	return len(src)
+}
+
+// renderEntry renders a nested block mapping entry, indented by indent spaces.
+func renderEntry(keys []string, value string, indent int) string {
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s%s:", strings.Repeat(" ", indent+2*i), renderScalar(k, 0))
+	}
+	fmt.Fprintf(&b, " %s\n", renderScalar(value, indent+2*len(keys)))
+	return b.String()
+}
+
+// renderScalar renders a string as a YAML scalar. Multi-line strings are rendered
+// as literal block scalars whose lines are indented by indent spaces.
+func renderScalar(s string, indent int) string {
+	if !strings.Contains(s, "\n") || strings.HasPrefix(s, " ") || strings.HasPrefix(s, "\n") {
+		if b, err := yaml.Marshal(s); err == nil && !strings.Contains(strings.TrimSuffix(string(b), "\n"), "\n") {
+			return strings.TrimSuffix(string(b), "\n")
+		}
+		b, _ := json.Marshal(s)
+		return string(b)
+	}
+
+	header := "|"
+	body := strings.TrimSuffix(s, "\n")
+	switch {
+	case !strings.HasSuffix(s, "\n"):
+		header = "|-"
+	case strings.HasSuffix(body, "\n"):
+		header = "|+"
+	}
+	var b strings.Builder
+	b.WriteString(header)
+	for _, l := range strings.Split(body, "\n") {
+		b.WriteString("\n")
+		if l != "" {
+			b.WriteString(strings.Repeat(" ", indent) + l)
+		}
+	}
+	return b.String()
+}
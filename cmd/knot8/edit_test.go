@@ -0,0 +1,147 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSetMapEntry(t *testing.T) {
+	testCases := []struct {
+		src   string
+		pos   int
+		ptr   string
+		key   string
+		value string
+		want  string
+	}{
+		{
+			"metadata:\n  name: foo\n  annotations:\n    a: b # comment\nspec: {}\n",
+			0, "/metadata/annotations", "knot8.io/x", "y",
+			"metadata:\n  name: foo\n  annotations:\n    a: b # comment\n    knot8.io/x: y\nspec: {}\n",
+		},
+		{
+			"metadata:\n  name: foo\n  annotations:\n    a: b\n",
+			0, "/metadata/annotations", "a", "c",
+			"metadata:\n  name: foo\n  annotations:\n    a: c\n",
+		},
+		{
+			"metadata:\n  name: Voilá\nspec: {}\n",
+			0, "/metadata/annotations", "x", "y",
+			"metadata:\n  name: Voilá\n  annotations:\n    x: y\nspec: {}\n",
+		},
+		{
+			"metadata:\n  name: foo\n  annotations: {}\n",
+			0, "/metadata/annotations", "x", "y",
+			"metadata:\n  name: foo\n  annotations: {\"x\":\"y\"}\n",
+		},
+		{
+			"a: 1\n---\nmetadata:\n  labels:\n    l: |\n      multi\n      line\n",
+			1, "/metadata/annotations", "x", "a\nb\n",
+			"a: 1\n---\nmetadata:\n  labels:\n    l: |\n      multi\n      line\n  annotations:\n    x: |\n      a\n      b\n",
+		},
+		{
+			"metadata:\n  name: foo",
+			0, "/metadata/annotations", "x", "true",
+			"metadata:\n  name: foo\n  annotations:\n    x: \"true\"\n",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			got, err := setMapEntry([]byte(tc.src), tc.pos, tc.ptr, tc.key, tc.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := string(got), tc.want; got != want {
+				t.Errorf("got: %q, want: %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRenameMapKey(t *testing.T) {
+	testCases := []struct {
+		src      string
+		pos      int
+		ptr      string
+		key, new string
+		want     string
+		found    bool
+	}{
+		{"a: 1\nb: 2\n", 0, "", "b", "c", "a: 1\nc: 2\n", true},
+		{"{a: 1, b: 2}", 0, "", "a", "c", "{c: 1, b: 2}", true},
+		{"a: 1\n", 0, "", "b", "c", "a: 1\n", false},
+		{
+			"x: 1\n---\nmetadata:\n  annotations:\n    \"field.knot8.io/b\": /x # doc\n",
+			1, "/metadata/annotations", "field.knot8.io/b", "field.knot8.io/c",
+			"x: 1\n---\nmetadata:\n  annotations:\n    \"field.knot8.io/c\": /x # doc\n",
+			true,
+		},
+		{"metadata:\n  name: foo\n", 0, "/metadata/annotations", "a", "b", "metadata:\n  name: foo\n", false},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			got, found, err := renameMapKey([]byte(tc.src), tc.pos, tc.ptr, tc.key, tc.new)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != tc.found {
+				t.Errorf("got: %v, want: %v", found, tc.found)
+			}
+			if got, want := string(got), tc.want; got != want {
+				t.Errorf("got: %q, want: %q", got, want)
+			}
+		})
+	}
+}
+
+func TestDeleteMapEntry(t *testing.T) {
+	testCases := []struct {
+		src   string
+		key   string
+		want  string
+		found bool
+	}{
+		{
+			"metadata:\n  name: a\n  annotations:\n    # doc\n    a: b\n    c: |\n      x\n    d: e\nspec: {}\n",
+			"a",
+			"metadata:\n  name: a\n  annotations:\n    c: |\n      x\n    d: e\nspec: {}\n",
+			true,
+		},
+		{
+			"metadata:\n  name: a\n  annotations:\n    a: b\n    c: |\n      x\n    d: e\nspec: {}\n",
+			"c",
+			"metadata:\n  name: a\n  annotations:\n    a: b\n    d: e\nspec: {}\n",
+			true,
+		},
+		{
+			"metadata:\n  name: a\n  annotations:\n    a: b\nspec: {}\n",
+			"a",
+			"metadata:\n  name: a\nspec: {}\n",
+			true,
+		},
+		{"metadata:\n  annotations: {a: b, c: d}\n", "a", "metadata:\n  annotations: {c: d}\n", true},
+		{"metadata:\n  annotations: {a: b, c: d}\n", "c", "metadata:\n  annotations: {a: b}\n", true},
+		{"metadata: {name: a, annotations: {a: b}}\n", "a", "metadata: {name: a}\n", true},
+		{"metadata:\n  name: a\n", "a", "metadata:\n  name: a\n", false},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			got, found, err := deleteMapEntry([]byte(tc.src), 0, "/metadata/annotations", tc.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != tc.found {
+				t.Errorf("got: %v, want: %v", found, tc.found)
+			}
+			if got, want := string(got), tc.want; got != want {
+				t.Errorf("got: %q, want: %q", got, want)
+			}
+		})
+	}
+}
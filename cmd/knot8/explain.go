@@ -0,0 +1,120 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type ExplainCmd struct {
+	CommonFlags
+	CommonSchemaFlags
+	SecretsFlags
+
+	Field  string `arg:"" optional:"" help:"Field to explain. Defaults to all fields."`
+	Format string `name:"format" enum:"yaml,dot" default:"yaml" help:"Output format (yaml, dot)."`
+}
+
+// An explainTarget describes a location pointed by a field.
+type explainTarget struct {
+	Resource   string   `yaml:"resource"`
+	APIVersion string   `yaml:"apiVersion"`
+	File       string   `yaml:"file"`
+	Line       int      `yaml:"line"`
+	Column     int      `yaml:"column"`
+	Pointer    string   `yaml:"pointer"`
+	Lenses     []string `yaml:"lenses,flow"`
+	Value      string   `yaml:"value"`
+}
+
+func (s *ExplainCmd) Run(ctx *Context) error {
+	manifestSet, err := openFields(s.Paths, s.Schema)
+	if err != nil && !isNotUniqueValueError(err) {
+		return err
+	}
+
+	names := manifestSet.Fields.Names()
+	if s.Field != "" {
+		k, err := manifestSet.Fields.lookup(canonicalName(manifestSet.Fields, s.Field))
+		if err != nil {
+			return err
+		}
+		names = []string{k.Name}
+	}
+
+	if s.Format == "dot" {
+		renderFieldsGraph(os.Stdout, manifestSet.Fields, names)
+		return nil
+	}
+
+	res := map[string][]explainTarget{}
+	for _, n := range names {
+		if res[n], err = explainField(manifestSet.Fields, n, s.ShowSecrets); err != nil {
+			return err
+		}
+	}
+	return yaml.NewEncoder(os.Stdout).Encode(res)
+}
+
+// explainField describes every location pointed by the field n. Unresolved pointers have an empty value.
+func explainField(fields Fields, n string, showSecrets bool) ([]explainTarget, error) {
+	var res []explainTarget
+	for _, p := range fields[n].Pointers {
+		file, line, col := p.Position()
+		t := explainTarget{
+			Resource:   p.Manifest.FQN().Short(),
+			APIVersion: p.Manifest.APIVersion,
+			File:       file,
+			Line:       line,
+			Column:     col,
+			Pointer:    p.Expr,
+			Lenses:     lensChain(p.Expr),
+		}
+		if v, err := (Field{Name: n, Pointers: []Pointer{p}}).GetAll(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: field %q: %v\n", n, err)
+		} else {
+			t.Value = fields.redact(n, v[0].value, showSecrets)
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+// lensChain returns the names of the lenses traversed by a pointer, starting with the implicit yaml lens.
+func lensChain(expr string) []string {
+	res := []string{"yaml"}
+	for _, c := range strings.Split(expr, "/") {
+		if strings.HasPrefix(c, "~(") && strings.HasSuffix(c, ")") {
+			res = append(res, strings.TrimSuffix(strings.TrimPrefix(c, "~("), ")"))
+		}
+	}
+	return res
+}
+
+// renderFieldsGraph renders a graph of the fields and the resources they point to, in the DOT language.
+func renderFieldsGraph(w io.Writer, fields Fields, names []string) {
+	q := strconv.Quote
+
+	fmt.Fprintln(w, "digraph knot8 {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	resources := map[string]bool{}
+	for _, n := range names {
+		fmt.Fprintf(w, "  %s [label=%s, shape=ellipse];\n", q("field:"+n), q(n))
+		for _, p := range fields[n].Pointers {
+			r := p.Manifest.FQN().Short()
+			if !resources[r] {
+				resources[r] = true
+				fmt.Fprintf(w, "  %s [label=%s, shape=box];\n", q("resource:"+r), q(r))
+			}
+			fmt.Fprintf(w, "  %s -> %s [label=%s];\n", q("field:"+n), q("resource:"+r), q(p.Expr))
+		}
+	}
+	fmt.Fprintln(w, "}")
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExplainField(t *testing.T) {
+	ms := parseTestManifestSet(t, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/a: /data/a
+    field.knot8.io/b: /data/cfg/~(yaml)/b
+data:
+  a: "1"
+  cfg: |
+    b: x
+`)
+	got, err := explainField(ms.Fields, "b", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []explainTarget{{
+		Resource:   "ConfigMap/demo",
+		APIVersion: "v1",
+		File:       "test.yaml",
+		Line:       10,
+		Column:     8,
+		Pointer:    "/data/cfg/~(yaml)/b",
+		Lenses:     []string{"yaml", "yaml"},
+		Value:      "x",
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
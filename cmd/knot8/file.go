@@ -21,6 +21,10 @@ import (
 type shadowFile struct {
 	name string
 	buf  []byte
+	// orig holds the content read from the file, before any change.
+	orig []byte
+	// dir is the directory of the file, used to resolve the paths relative to the file.
+	dir string
 }
 
 func newShadowFile(filename string) (*shadowFile, error) {
@@ -43,7 +47,7 @@ func newShadowFile(filename string) (*shadowFile, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &shadowFile{name: filename, buf: buf}, nil
+	return &shadowFile{name: filename, buf: buf, orig: buf, dir: filepath.Dir(filename)}, nil
 }
 
 func (f *shadowFile) Commit() error {
@@ -52,7 +56,7 @@ func (f *shadowFile) Commit() error {
 	if f.name == "-" {
 		w = os.Stdout
 	} else {
-		file, err := os.OpenFile(f.name, os.O_WRONLY|os.O_TRUNC, 0)
+		file, err := os.OpenFile(f.name, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
 		if err != nil {
 			return err
 		}
@@ -64,6 +68,11 @@ func (f *shadowFile) Commit() error {
 	return err
 }
 
+// Diff returns the unified diff of the changes made to the file.
+func (f *shadowFile) Diff() string {
+	return unifiedDiff(f.name, f.name, f.orig, f.buf)
+}
+
 // expandPaths will expand all path entries and return a slice of file paths.
 // If an input path points to a directory it will return all *.yaml files contained in it.
 // Shell globs are resolved.
@@ -0,0 +1,110 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Strategies used to reconcile the divergent values of a field (see reconcileFields).
+const (
+	preferMajority = "majority"
+	preferOriginal = "original"
+)
+
+// A fieldFix is a change made to reconcile the values of a field.
+type fieldFix struct {
+	Field string
+	Ptr   Pointer
+	Old   string
+	New   string
+}
+
+// reconcileFields adds to the batch the edits that make all the values pointed by each field the same.
+// The value is chosen according to prefer, which is either "majority" (the most common value, or the first one
+// in case of ties), "original" (the value recorded in the knot8.io/original annotation) or the name of a resource
+// (Kind/name or Kind/namespace/name) or of a file, whose value is used.
+// Fields whose value cannot be chosen are reported as warnings and left untouched.
+// If the batch enforces a policy (see EditBatch.Enforce), the edits forbidden by the policy are errors.
+func reconcileFields(ms *ManifestSet, b EditBatch, prefer string) ([]fieldFix, error) {
+	o, err := findOriginal(ms)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		res  []fieldFix
+		errs []error
+	)
+	for _, n := range ms.Fields.Names() {
+		values, err := ms.Fields[n].GetAll()
+		if err != nil || checkFieldValues(values) {
+			// unresolved pointers cannot be fixed.
+			continue
+		}
+
+		v, ok := "", false
+		switch prefer {
+		case preferMajority:
+			v, ok = majorityValue(values), true
+		case preferOriginal:
+			v, ok = o[n]
+		default:
+			for _, t := range values {
+				if t.ptr.Manifest.FQN().Short() == prefer || t.ptr.Manifest.source.file.name == prefer {
+					v, ok = t.value, true
+					break
+				}
+			}
+		}
+		if !ok {
+			fmt.Fprintf(os.Stderr, "warning: cannot reconcile the values of field %q: no %s value\n", n, prefer)
+			continue
+		}
+
+		for _, t := range values {
+			if t.value == v {
+				continue
+			}
+			if b.policy != nil {
+				if err := b.policy.checkChange(ms.Fields[n], t.value, v); err != nil {
+					errs = append(errs, err)
+					break
+				}
+			}
+			b.add(t.ptr, v)
+			res = append(res, fieldFix{Field: n, Ptr: t.ptr, Old: t.value, New: v})
+		}
+	}
+	if errs != nil {
+		return nil, errors.Join(errs...)
+	}
+	return res, nil
+}
+
+// majorityValue returns the most common value, or the first one among the most common values.
+func majorityValue(values []FieldTarget) string {
+	count := map[string]int{}
+	for _, t := range values {
+		count[t.value]++
+	}
+	res := values[0].value
+	for _, t := range values {
+		if count[t.value] > count[res] {
+			res = t.value
+		}
+	}
+	return res
+}
+
+func renderFixes(w io.Writer, fields Fields, fixes []fieldFix, showSecrets bool) {
+	for _, f := range fixes {
+		file, line, col := f.Ptr.Position()
+		fmt.Fprintf(w, "%s:%d:%d: fixed field %q (%s): %q -> %q\n", file, line, col, f.Field, f.Ptr,
+			fields.redact(f.Field, f.Old, showSecrets), fields.redact(f.Field, f.New, showSecrets))
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const reconcileTestManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+  annotations:
+    field.knot8.io/f: /data/f
+    knot8.io/original: |
+      f: orig
+data:
+  f: x
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: b
+  annotations:
+    field.knot8.io/f: /data/f
+data:
+  f: y
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: c
+  annotations:
+    field.knot8.io/f: /data/f
+data:
+  f: y
+`
+
+func TestReconcileFields(t *testing.T) {
+	src := reconcileTestManifest
+	testCases := []struct {
+		prefer string
+		want   string
+		fixes  int
+	}{
+		{preferMajority, "y", 1},
+		{preferOriginal, "orig", 3},
+		{"ConfigMap/a", "x", 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.prefer, func(t *testing.T) {
+			ms := parseTestManifestSet(t, src)
+			b := ms.NewEditBatch()
+			fixes, err := reconcileFields(ms, b, tc.prefer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := len(fixes), tc.fixes; got != want {
+				t.Errorf("got: %d, want: %d", got, want)
+			}
+			got, err := ms.Fields.GetValue("f")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("got: %q, want: %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReconcileFieldsPolicy(t *testing.T) {
+	src := strings.Replace(reconcileTestManifest, "    field.knot8.io/f: /data/f\n    knot8.io/original:", "    field.knot8.io/f: /data/f\n    immutable.knot8.io/f: \"true\"\n    knot8.io/original:", 1)
+	ms := parseTestManifestSet(t, src)
+	b := ms.NewEditBatch()
+	if err := b.Enforce(ms, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reconcileFields(ms, b, preferMajority); err == nil {
+		t.Errorf("expecting error for immutable field")
+	}
+}
+
+// TestLintFixJSON checks that the report of the fixes doesn't corrupt the JSON output.
+func TestLintFixJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.yaml")
+	if err := os.WriteFile(path, []byte(reconcileTestManifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := LintCmd{CommonFlags: CommonFlags{Paths: []string{path}}, Fix: true, Prefer: preferMajority, Format: "json"}
+	out := captureStdout(t, func() {
+		if err := s.Run(&Context{}); err != nil {
+			t.Error(err)
+		}
+	})
+	var findings []lintFinding
+	if err := json.Unmarshal(out, &findings); err != nil {
+		t.Fatalf("%v: %q", err, out)
+	}
+	if got, want := len(findings), 0; got != want {
+		t.Errorf("got: %d, want: %d", got, want)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type FreezeCmd struct {
+	CommonFlags
+	CommonSchemaFlags
+	CommonPolicyFlags
+	SecretsFlags
+
+	Resource string `name:"resource" help:"Resource (Kind/name or Kind/namespace/name) where to store the original values if there is no knot8.io/original annotation yet."`
+	Baseline string `name:"baseline" enum:",inline,gzip,file" default:"" help:"How to store the original values: inline, gzip (compressed annotation) or file (sidecar file). Defaults to the current form, or inline."`
+	Stdout   bool   `name:"stdout" help:"Output to stdout and never update files in-place"`
+	Diff     bool   `name:"diff" help:"Show a unified diff of the changes instead of writing them."`
+}
+
+func (s *FreezeCmd) Run(ctx *Context) error {
+	manifestSet, err := openFields(s.Paths, s.Schema)
+	if err != nil {
+		return err
+	}
+	manifestSet.showSecrets = s.ShowSecrets
+	if s.Stdout {
+		for _, m := range manifestSet.Manifests {
+			m.source.file.name = "-"
+		}
+	}
+
+	policy, err := s.CommonPolicyFlags.load()
+	if err != nil {
+		return err
+	}
+	if err := freeze(manifestSet, s.Resource, s.Baseline, policy); err != nil {
+		return err
+	}
+
+	if s.Diff {
+		return manifestSet.Diff(os.Stdout)
+	}
+	return manifestSet.Commit()
+}
+
+// freeze saves the current values of the fields in the knot8.io/original annotations.
+//
+// The fields are partitioned by the file holding their first pointer, so that each file
+// carries the original values of its own fields only. Fields whose original value is already
+// stored in a file are kept there. In each file, the values are saved in the
+// resources that already have a knot8.io/original annotation; if there is none, the annotation
+// is added to the designated resource, if it's in that file, or to the first resource defining fields.
+//
+// Immutable fields (see Policy.isImmutable) keep their recorded original value, if any,
+// so that freezing doesn't unlock them.
+//
+// The values are stored in the given form (see baselineForm); if empty, the current form
+// of each annotation is retained.
+func freeze(ms *ManifestSet, resource, form string, p *Policy) error {
+	switch form {
+	case "", baselineInline, baselineGzip, baselineFile:
+	default:
+		return fmt.Errorf("unknown baseline form %q", form)
+	}
+
+	var (
+		files   []*shadowFile
+		byFile  = map[*shadowFile]Fields{}
+		holders = map[*shadowFile][]*Manifest{}
+		stored  = map[string]*shadowFile{}
+		kept    = map[string]string{}
+		found   bool
+	)
+	for _, m := range ms.Manifests {
+		if m.FQN().Short() == resource {
+			found = true
+		}
+		if _, ok := m.Metadata.Annotations[originalAnno]; !ok {
+			continue
+		}
+		f := m.source.file
+		holders[f] = append(holders[f], m)
+		o, err := ms.decodeOriginalAnno(m)
+		if err != nil {
+			return err
+		}
+		var values map[string]string
+		if err := yaml.Unmarshal([]byte(o), &values); err != nil {
+			return err
+		}
+		for n, v := range values {
+			if _, ok := stored[n]; ok {
+				continue
+			}
+			stored[n] = f
+			if k, ok := ms.Fields[n]; ok && p.isImmutable(k) {
+				kept[n] = v
+			}
+		}
+	}
+
+	for _, n := range ms.Fields.Names() {
+		k := ms.Fields[n]
+		f, ok := stored[n]
+		if !ok {
+			f = k.Pointers[0].Manifest.source.file
+		}
+		if byFile[f] == nil {
+			files = append(files, f)
+			byFile[f] = Fields{}
+		}
+		byFile[f][n] = k
+	}
+	if resource != "" && !found {
+		return fmt.Errorf("cannot find resource %q", resource)
+	}
+
+	for _, f := range files {
+		if len(holders[f]) > 0 {
+			continue
+		}
+		var first, designated *Manifest
+		for _, m := range ms.Manifests {
+			if m.source.file != f {
+				continue
+			}
+			if first == nil && definesFields(m) {
+				first = m
+			}
+			if m.FQN().Short() == resource {
+				designated = m
+			}
+		}
+		if designated != nil {
+			first = designated
+		}
+		if first == nil {
+			// fields defined only out of band (Knot8file); pick the resource holding the first pointer.
+			first = byFile[f][byFile[f].Names()[0]].Pointers[0].Manifest
+		}
+		holders[f] = []*Manifest{first}
+	}
+
+	for f, hs := range holders {
+		body, err := renderOriginalAnnoBody(byFile[f], kept)
+		if err != nil {
+			return err
+		}
+		for _, m := range hs {
+			fm := form
+			if fm == "" {
+				fm = baselineForm(m.Metadata.Annotations[originalAnno])
+			}
+			anno, err := ms.encodeOriginalAnno(m, body, fm)
+			if err != nil {
+				return err
+			}
+			if err := setOriginalAnno(m, anno); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func definesFields(m *Manifest) bool {
+	for k := range m.Metadata.Annotations {
+		if strings.HasPrefix(k, annoPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func setOriginalAnno(m *Manifest, body string) error {
+	f := m.source.file
+	b, err := setMapEntry(f.buf, m.source.streamPos, "/metadata/annotations", originalAnno, body)
+	if err != nil {
+		return err
+	}
+	f.buf = b
+	if m.Metadata.Annotations == nil {
+		m.Metadata.Annotations = map[string]string{}
+	}
+	m.Metadata.Annotations[originalAnno] = body
+	return nil
+}
@@ -0,0 +1,248 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFreeze(t *testing.T) {
+	ms := parseTestFiles(t, []*shadowFile{
+		{name: "a.yaml", buf: []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+  annotations:
+    field.knot8.io/a: /data/a
+    field.knot8.io/b: /data/b
+data:
+  a: "1"
+  b: "1"
+`)},
+		{name: "b.yaml", buf: []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: b
+  annotations:
+    field.knot8.io/c: /data/c
+    field.knot8.io/b: /data/b
+data:
+  b: "1"
+  c: "2"
+`)},
+	})
+
+	if err := freeze(ms, "ConfigMap/other", "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"a":     "a: \"1\"\nb: \"1\"\n",
+		"other": "c: \"2\"\n",
+	}
+	for _, m := range ms.Manifests {
+		if got, want := m.Metadata.Annotations[originalAnno], want[m.Metadata.Name]; got != want {
+			t.Errorf("%s: got: %q, want: %q", m.Metadata.Name, got, want)
+		}
+	}
+
+	got, err := findOriginal(ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"a": "1", "b": "1", "c": "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+// TestFreezeStored checks that the fields whose original value is already stored in a file stay there,
+// even if their first pointer is in another file.
+func TestFreezeStored(t *testing.T) {
+	ms := parseTestFiles(t, []*shadowFile{
+		{name: "a.yaml", buf: []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+  annotations:
+    field.knot8.io/a: /data/a
+    knot8.io/original: |
+      a: "0"
+      c: "0"
+data:
+  a: "1"
+`)},
+		{name: "b.yaml", buf: []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: b
+  annotations:
+    field.knot8.io/c: /data/c
+    field.knot8.io/d: /data/d
+data:
+  c: "2"
+  d: "3"
+`)},
+	})
+
+	if err := freeze(ms, "", "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"a": "a: \"1\"\nc: \"2\"\n",
+		"b": "d: \"3\"\n",
+	}
+	for _, m := range ms.Manifests {
+		if got, want := m.Metadata.Annotations[originalAnno], want[m.Metadata.Name]; got != want {
+			t.Errorf("%s: got: %q, want: %q", m.Metadata.Name, got, want)
+		}
+	}
+}
+
+func TestFreezeEncrypted(t *testing.T) {
+	setTestAgeKey(t)
+	path := filepath.Join(t.TempDir(), "test.yaml")
+	src := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/password: /data/password/~(age)
+data:
+  password: ""
+`
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ms, err := openFields([]string{path}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := ms.NewEditBatch()
+	if err := b.Set("password", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&FreezeCmd{CommonFlags: CommonFlags{Paths: []string{path}}}).Run(&Context{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(got), "hunter2") {
+		t.Fatalf("plaintext leaked in:\n%s", got)
+	}
+
+	ms, err = openFields([]string{path}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := findOriginal(ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := o["password"], "hunter2"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+	d, err := diff(ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d) != 0 {
+		t.Errorf("unexpected changes: %v", d)
+	}
+}
+
+// TestFreezeImmutable checks that freezing doesn't unlock the immutable fields that already
+// diverged from their original value.
+func TestFreezeImmutable(t *testing.T) {
+	src := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/a: /data/a
+    field.knot8.io/sc: /data/sc
+    field.knot8.io/size: /data/size
+    immutable.knot8.io/sc: "true"
+    knot8.io/original: |
+      a: x
+      sc: standard
+      size: 1Gi
+data:
+  a: x
+  sc: standard
+  size: 1Gi
+`
+	p := &Policy{Immutable: []string{"size"}}
+	ms := parseTestManifestSet(t, src)
+	b := ms.NewEditBatch()
+	if err := b.Enforce(ms, p); err != nil {
+		t.Fatal(err)
+	}
+	for n, v := range map[string]string{"a": "y", "sc": "fast", "size": "2Gi"} {
+		if err := b.Set(n, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := freeze(ms, "", "", p); err != nil {
+		t.Fatal(err)
+	}
+
+	ms = parseTestManifestSet(t, string(ms.Manifests[0].source.file.buf))
+	o, err := findOriginal(ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"a": "y", "sc": "standard", "size": "1Gi"}; !reflect.DeepEqual(o, want) {
+		t.Errorf("got: %v, want: %v", o, want)
+	}
+	b = ms.NewEditBatch()
+	if err := b.Enforce(ms, p); err != nil {
+		t.Fatal(err)
+	}
+	for n, v := range map[string]string{"sc": "slow", "size": "3Gi"} {
+		if err := b.Set(n, v); err == nil {
+			t.Errorf("expecting error setting immutable field %q", n)
+		}
+	}
+}
+
+// parseTestFiles parses a manifest set spanning several files.
+func parseTestFiles(t *testing.T, files []*shadowFile) *ManifestSet {
+	t.Helper()
+	var manifests Manifests
+	for _, f := range files {
+		ms, err := parseManifests(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifests = append(manifests, ms...)
+	}
+	fields, err := parseFields(manifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ManifestSet{Manifests: manifests, Fields: fields}
+}
@@ -0,0 +1,179 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	generatePrefix = "generate.knot8.io/"
+
+	// generatedAnno lists the fields whose values have been generated by knot8.
+	// Generated values are always retained when pulling a new upstream version.
+	generatedAnno = "knot8.io/generated"
+
+	defaultGeneratedLength = 32
+)
+
+var alphabets = map[string]string{
+	"alnum":   "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+	"alpha":   "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+	"numeric": "0123456789",
+	"hex":     "0123456789abcdef",
+	"base64":  "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/",
+}
+
+// generateValue returns a random value according to a generator spec.
+// The spec has the form format[:length], where format is either "uuid",
+// one of the named alphabets (alnum, alpha, numeric, hex, base64),
+// or a custom alphabet enclosed in square brackets, e.g. "[abc123]:16".
+// The length defaults to 32 characters.
+func generateValue(spec string) (string, error) {
+	format, length := spec, defaultGeneratedLength
+	if i := strings.LastIndex(spec, ":"); i >= 0 && !strings.HasSuffix(spec, "]") {
+		l, err := strconv.Atoi(spec[i+1:])
+		if err != nil || l <= 0 {
+			return "", fmt.Errorf("bad generator length in %q", spec)
+		}
+		format, length = spec[:i], l
+	}
+
+	if format == "uuid" {
+		return randomUUID()
+	}
+
+	alphabet, ok := alphabets[format]
+	if strings.HasPrefix(format, "[") && strings.HasSuffix(format, "]") && len(format) > 2 {
+		alphabet, ok = format[1:len(format)-1], true
+	}
+	if !ok {
+		return "", fmt.Errorf("unknown generator format %q", format)
+	}
+	return randomString([]rune(alphabet), length)
+}
+
+func randomString(alphabet []rune, length int) (string, error) {
+	res := make([]rune, length)
+	max := big.NewInt(int64(len(alphabet)))
+	for i := range res {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		res[i] = alphabet[n.Int64()]
+	}
+	return string(res), nil
+}
+
+func randomUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// generated returns the set of fields whose values have been generated.
+func (ms *ManifestSet) generated() map[string]bool {
+	res := map[string]bool{}
+	for _, m := range ms.Manifests {
+		for _, n := range splitList(m.Metadata.Annotations[generatedAnno]) {
+			res[n] = true
+		}
+	}
+	return res
+}
+
+// generateValues adds to the batch random values for all the fields that declare a generator
+// and still hold their placeholder value, except for the fields in skip.
+// The placeholder is the original value of the field, if recorded, or else its current value,
+// since a field that has never been generated still holds the value it has been shipped with.
+// It returns the names of the fields whose values have been generated.
+func (ms *ManifestSet) generateValues(b EditBatch, skip map[string]bool) ([]string, error) {
+	o, err := findOriginal(ms)
+	if err != nil {
+		return nil, err
+	}
+	gen := ms.generated()
+
+	var res []string
+	for _, n := range ms.Fields.Names() {
+		k := ms.Fields[n]
+		if k.Generator == "" || skip[n] || gen[n] {
+			continue
+		}
+		v, err := ms.Fields.GetValue(n)
+		if err != nil {
+			return nil, err
+		}
+		if orig, ok := o[n]; ok && v != "" && v != orig {
+			continue
+		}
+		g, err := generateValue(k.Generator)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", n, err)
+		}
+		if err := b.Set(n, g); err != nil {
+			return nil, err
+		}
+		res = append(res, n)
+	}
+	return res, nil
+}
+
+// markGenerated records that the values of the given fields have been generated, in the
+// knot8.io/generated annotation of the resource holding the first pointer of each field.
+func (ms *ManifestSet) markGenerated(names []string) error {
+	add := map[*Manifest][]string{}
+	for _, n := range names {
+		if k, ok := ms.Fields[n]; ok {
+			m := k.Pointers[0].Manifest
+			add[m] = append(add[m], n)
+		}
+	}
+
+	for m, ns := range add {
+		all := map[string]bool{}
+		for _, n := range append(splitList(m.Metadata.Annotations[generatedAnno]), ns...) {
+			all[n] = true
+		}
+		var list []string
+		for n := range all {
+			list = append(list, n)
+		}
+		sort.Strings(list)
+		v := strings.Join(list, ",")
+
+		f := m.source.file
+		b, err := setMapEntry(f.buf, m.source.streamPos, "/metadata/annotations", generatedAnno, v)
+		if err != nil {
+			return err
+		}
+		f.buf = b
+		if m.Metadata.Annotations == nil {
+			m.Metadata.Annotations = map[string]string{}
+		}
+		m.Metadata.Annotations[generatedAnno] = v
+	}
+	return nil
+}
+
+// splitList splits a comma separated list, ignoring empty elements.
+func splitList(s string) []string {
+	var res []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			res = append(res, e)
+		}
+	}
+	return res
+}
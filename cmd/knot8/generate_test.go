@@ -0,0 +1,163 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGenerateValue(t *testing.T) {
+	testCases := []struct {
+		spec string
+		re   string
+	}{
+		{"alnum", `^[A-Za-z0-9]{32}$`},
+		{"hex:16", `^[0-9a-f]{16}$`},
+		{"numeric:4", `^[0-9]{4}$`},
+		{"[ab:]:8", `^[ab:]{8}$`},
+		{"[xy]", `^[xy]{32}$`},
+		{"uuid", `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			got, err := generateValue(tc.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !regexp.MustCompile(tc.re).MatchString(got) {
+				t.Errorf("%q doesn't match %q", got, tc.re)
+			}
+		})
+	}
+
+	for _, spec := range []string{"bogus", "hex:0", "hex:x", "[]"} {
+		if _, err := generateValue(spec); err == nil {
+			t.Errorf("expecting error for %q", spec)
+		}
+	}
+}
+
+const generateTestManifest = `apiVersion: v1
+kind: Secret
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/a: /stringData/a
+    field.knot8.io/b: /stringData/b
+    field.knot8.io/c: /stringData/c
+    field.knot8.io/d: /stringData/d
+    field.knot8.io/e: /stringData/e
+    field.knot8.io/f: /stringData/f
+    field.knot8.io/g: /stringData/g
+    generate.knot8.io/a: hex:8
+    generate.knot8.io/b: hex:8
+    generate.knot8.io/c: hex:8
+    generate.knot8.io/e: hex:8
+    generate.knot8.io/f: hex:8
+    generate.knot8.io/g: hex:8
+    knot8.io/generated: f
+    knot8.io/original: |
+      a: changeme
+      c: changeme
+stringData:
+  a: changeme
+  b: ""
+  c: custom
+  d: ""
+  e: ""
+  f: 0123abcd
+  g: changeme
+`
+
+func TestGenerateValues(t *testing.T) {
+	ms := parseTestManifestSet(t, generateTestManifest)
+	b := ms.NewEditBatch()
+	// a holds its original value and b is empty; c has been customized, d has no generator,
+	// e is skipped and f has already been generated; g has no original value, so it still holds its placeholder.
+	got, err := ms.generateValues(b, map[string]bool{"e": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "g"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"c": "custom", "d": "", "e": "", "f": "0123abcd"}
+	for _, n := range ms.Fields.Names() {
+		v, err := ms.Fields.GetValue(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w, ok := want[n]; ok && v != w {
+			t.Errorf("%s: got: %q, want: %q", n, v, w)
+		} else if !ok && !regexp.MustCompile(`^[0-9a-f]{8}$`).MatchString(v) {
+			t.Errorf("%s: %q is not a generated value", n, v)
+		}
+	}
+}
+
+func TestMarkGenerated(t *testing.T) {
+	ms := parseTestManifestSet(t, generateTestManifest)
+	if err := ms.markGenerated([]string{"b", "a", "f"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ms.Manifests[0].Metadata.Annotations[generatedAnno], "a,b,f"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	res, err := parseManifests(ms.Manifests[0].source.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := res[0].Metadata.Annotations[generatedAnno], "a,b,f"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+// TestPullGenerated checks that pull retains the generated values, even if they hold
+// the upstream default, and carries over the knot8.io/generated annotation.
+func TestPullGenerated(t *testing.T) {
+	dir := t.TempDir()
+	cur, up := filepath.Join(dir, "current.yaml"), filepath.Join(dir, "upstream.yaml")
+	src := strings.Replace(generateTestManifest, "\n  a: changeme\n", "\n  a: 0a0a0a0a\n", 1)
+	src = strings.Replace(src, "knot8.io/generated: f", "knot8.io/generated: a,f", 1)
+	if err := os.WriteFile(cur, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// upstream changes the default of f, which has been generated.
+	upstream := strings.Replace(generateTestManifest, "knot8.io/generated: f", "knot8.io/generated: \"\"", 1)
+	upstream = strings.Replace(upstream, "  f: 0123abcd\n", "  f: \"\"\n", 1)
+	if err := os.WriteFile(up, []byte(upstream), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := PullCmd{CommonFlags: CommonFlags{Paths: []string{cur}}, Upstream: up}
+	if err := s.Run(&Context{}); err != nil {
+		t.Fatal(err)
+	}
+	ms, err := openFields([]string{cur}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, want := range map[string]string{"a": "0a0a0a0a", "f": "0123abcd"} {
+		if got, err := ms.Fields.GetValue(n); err != nil {
+			t.Fatal(err)
+		} else if got != want {
+			t.Errorf("%s: got: %q, want: %q", n, got, want)
+		}
+	}
+	if got, want := ms.Manifests[0].Metadata.Annotations[generatedAnno], "a,f"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"knot8.io/pkg/lensed"
+)
+
+// parseTestManifestSet parses a manifest set with inline fields from a YAML stream.
+func parseTestManifestSet(t *testing.T, src string) *ManifestSet {
+	t.Helper()
+	ms, err := parseManifests(&shadowFile{name: "test.yaml", buf: []byte(src)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, err := parseFields(ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ManifestSet{Manifests: ms, Fields: fields}
+}
+
+// copyTestdata copies a file from the top level testdata directory to a temporary directory
+// and returns the path of the copy, so that tests can edit it in-place.
+func copyTestdata(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("..", "..", "testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), filepath.Base(name))
+	if err := os.WriteFile(dst, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dst
+}
+
+// captureStdout returns what f writes to the standard output.
+func captureStdout(t *testing.T, f func()) []byte {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- b
+	}()
+	f()
+	w.Close()
+	return <-out
+}
+
+// setTestAgeKey generates an age identity used by the age lens for the duration of the test.
+func setTestAgeKey(t *testing.T) {
+	t.Helper()
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "age.key")
+	if err := os.WriteFile(keyFile, []byte(id.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(lensed.AgeKeyFileEnv, keyFile)
+}
@@ -0,0 +1,278 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yptr "github.com/vmware-labs/yaml-jsonpointer"
+	"gopkg.in/yaml.v3"
+)
+
+type InitCmd struct {
+	CommonFlags
+	CommonSchemaFlags
+	SecretsFlags
+
+	Inline bool `name:"inline" help:"Add the field definitions as annotations of the resources instead of writing them to the schema file (Knot8file by default)."`
+	List   bool `name:"list" help:"Only list the suggested fields."`
+	Stdout bool `name:"stdout" help:"Output to stdout and never update files in-place"`
+	Diff   bool `name:"diff" help:"Show a unified diff of the changes instead of writing them."`
+}
+
+func (s *InitCmd) Run(ctx *Context) error {
+	manifestSet, err := openFields(s.Paths, existingSchema(s.Schema))
+	if err != nil && !isNotUniqueValueError(err) {
+		return err
+	}
+	manifestSet.showSecrets = s.ShowSecrets
+
+	suggestions := suggestFields(manifestSet.Manifests, manifestSet.Fields)
+	if len(suggestions) == 0 {
+		fmt.Fprintf(os.Stderr, "no fields to suggest\n")
+		return nil
+	}
+	if s.List {
+		for _, g := range suggestions {
+			fmt.Printf("%s\t%s\n", g.Name, g.Pointer)
+		}
+		return nil
+	}
+
+	if s.Inline {
+		if s.Stdout {
+			for _, m := range manifestSet.Manifests {
+				m.source.file.name = "-"
+			}
+		}
+		for _, g := range suggestions {
+			if err := setFieldAnno(g.Pointer.Manifest, g.Name, g.Pointer.Expr); err != nil {
+				return err
+			}
+		}
+		if s.Diff {
+			return manifestSet.Diff(os.Stdout)
+		}
+		return manifestSet.Commit()
+	}
+
+	path := s.Schema
+	if path == "" {
+		path = Knot8file
+	}
+	f, err := newShadowFile(path)
+	if os.IsNotExist(err) {
+		f, err = &shadowFile{name: path, dir: filepath.Dir(path)}, nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, g := range suggestions {
+		if err := addSchemaAnno(f, g.Pointer.Manifest, annoPrefix+g.Name, g.Pointer.Expr, ""); err != nil {
+			return err
+		}
+	}
+	switch {
+	case s.Diff:
+		fmt.Print(f.Diff())
+		return nil
+	case s.Stdout:
+		f.name = "-"
+	}
+	return f.Commit()
+}
+
+// A fieldSuggestion is a field proposed by init.
+type fieldSuggestion struct {
+	Name    string
+	Pointer Pointer
+
+	// path holds the components of the fully qualified name of the field, the first being the
+	// resource kind and name. The name of the field is the shortest unique suffix of the path,
+	// at least minLen components long.
+	path   []string
+	minLen int
+}
+
+// suggestFields suggests fields for the common tunables of the manifests: replicas,
+// container images, environment variables and resources, ConfigMap data keys and Service ports.
+// Values already pointed by a field are skipped and the names of the existing fields are not reused.
+func suggestFields(ms Manifests, fields Fields) []fieldSuggestion {
+	pointed := map[string]bool{}
+	for _, k := range fields {
+		for _, p := range k.Pointers {
+			pointed[p.String()] = true
+		}
+	}
+
+	var res []fieldSuggestion
+	for _, m := range ms {
+		root := m.root()
+		prefix := []string{strings.ToLower(m.Kind), m.Metadata.Name}
+		add := func(ptr string, minLen int, path ...string) {
+			p := Pointer{Expr: ptr, Manifest: m}
+			if pointed[p.String()] {
+				return
+			}
+			res = append(res, fieldSuggestion{Pointer: p, path: append(append([]string{}, prefix...), path...), minLen: minLen})
+		}
+
+		if n, err := yptr.Find(root, "/spec/replicas"); err == nil && n.Kind == yaml.ScalarNode && m.Kind != "Pod" {
+			add("/spec/replicas", 1, "replicas")
+		}
+		if ps, ok := podSpecPaths[m.Kind]; ok {
+			for _, cs := range []string{"initContainers", "containers"} {
+				suggestContainerFields(root, "/"+ps+"/"+cs, add)
+			}
+		}
+		switch m.Kind {
+		case "ConfigMap":
+			if d, err := yptr.Find(root, "/data"); err == nil && d.Kind == yaml.MappingNode {
+				for i := 0; i+1 < len(d.Content); i += 2 {
+					k, v := d.Content[i], d.Content[i+1]
+					// multi-line values are usually whole files, better addressed via lenses.
+					if v.Kind == yaml.ScalarNode && !strings.Contains(v.Value, "\n") {
+						add("/data/"+escapePointerToken(k.Value), 1, k.Value)
+					}
+				}
+			}
+		case "Service":
+			if ports, err := yptr.Find(root, "/spec/ports"); err == nil && ports.Kind == yaml.SequenceNode {
+				for i, p := range ports.Content {
+					tok := elementToken(ports, i)
+					path := []string{"port"}
+					if n, err := yptr.Find(p, "/name"); err == nil {
+						path = []string{n.Value, "port"}
+					} else if len(ports.Content) > 1 {
+						path = []string{fmt.Sprint(i), "port"}
+					}
+					add("/spec/ports/"+tok+"/port", 1, path...)
+				}
+			}
+		}
+	}
+
+	nameSuggestions(res, fields)
+
+	var out []fieldSuggestion
+	for _, g := range res {
+		if g.Name != "" {
+			out = append(out, g)
+		}
+	}
+	return out
+}
+
+// suggestContainerFields suggests the image, environment variables and resources of the containers
+// in the sequence pointed by cs.
+func suggestContainerFields(root *yaml.Node, cs string, add func(ptr string, minLen int, path ...string)) {
+	containers, err := yptr.Find(root, cs)
+	if err != nil || containers.Kind != yaml.SequenceNode {
+		return
+	}
+	for i, c := range containers.Content {
+		name := fmt.Sprint(i)
+		if n, err := yptr.Find(c, "/name"); err == nil {
+			name = n.Value
+		}
+		base := cs + "/" + elementToken(containers, i)
+
+		if img, err := yptr.Find(c, "/image"); err == nil && img.Kind == yaml.ScalarNode {
+			add(base+"/image/~(oci)/image", 1, name, "image")
+			if !strings.Contains(img.Value, "@") || strings.Contains(strings.Split(img.Value, "@")[0], ":") {
+				add(base+"/image/~(oci)/tag", 2, name, "tag")
+			}
+			if strings.Contains(img.Value, "@sha256:") {
+				add(base+"/image/~(oci)/digest", 2, name, "digest")
+			}
+		}
+
+		if env, err := yptr.Find(c, "/env"); err == nil && env.Kind == yaml.SequenceNode {
+			for j, e := range env.Content {
+				n, err := yptr.Find(e, "/name")
+				if err != nil {
+					continue
+				}
+				if v, err := yptr.Find(e, "/value"); err == nil && v.Kind == yaml.ScalarNode {
+					add(base+"/env/"+elementToken(env, j)+"/value", 2, name, "env", n.Value)
+				}
+			}
+		}
+
+		for _, kind := range []string{"requests", "limits"} {
+			r, err := yptr.Find(c, "/resources/"+kind)
+			if err != nil || r.Kind != yaml.MappingNode {
+				continue
+			}
+			for j := 0; j+1 < len(r.Content); j += 2 {
+				if k, v := r.Content[j], r.Content[j+1]; v.Kind == yaml.ScalarNode {
+					add(base+"/resources/"+kind+"/"+escapePointerToken(k.Value), 2, name, kind, k.Value)
+				}
+			}
+		}
+	}
+}
+
+// nameSuggestions names each suggestion after the shortest suffix of its path that is unique
+// among the suggestions and doesn't clash with the existing fields. Suggestions that cannot be
+// named uniquely are left unnamed.
+func nameSuggestions(gs []fieldSuggestion, fields Fields) {
+	nameOf := func(g fieldSuggestion, l int) string {
+		if l > len(g.path) {
+			l = len(g.path)
+		}
+		return strings.Join(g.path[len(g.path)-l:], ".")
+	}
+
+	lens := make([]int, len(gs))
+	for i, g := range gs {
+		lens[i] = g.minLen
+	}
+	for {
+		byName := map[string][]int{}
+		for i, g := range gs {
+			byName[nameOf(g, lens[i])] = append(byName[nameOf(g, lens[i])], i)
+		}
+		changed := false
+		for n, is := range byName {
+			_, exists := fields[n]
+			if len(is) == 1 && !exists {
+				continue
+			}
+			for _, i := range is {
+				if lens[i] < len(gs[i].path) {
+					lens[i]++
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	byName := map[string][]int{}
+	for i, g := range gs {
+		byName[nameOf(g, lens[i])] = append(byName[nameOf(g, lens[i])], i)
+	}
+	names := make([]string, 0, len(byName))
+	for n := range byName {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		is := byName[n]
+		if _, exists := fields[n]; len(is) > 1 || exists {
+			for _, i := range is {
+				fmt.Fprintf(os.Stderr, "warning: cannot find a unique name for %s\n", gs[i].Pointer)
+			}
+			continue
+		}
+		gs[is[0]].Name = n
+	}
+}
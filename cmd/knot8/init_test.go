@@ -0,0 +1,92 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSuggestFields(t *testing.T) {
+	ms := parseTestManifestSet(t, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/replicas: /spec/replicas
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: app
+        image: nginx:1.2
+        env:
+        - name: FOO
+          value: "x"
+        - name: BAR
+          valueFrom: {}
+        resources:
+          limits:
+            cpu: 200m
+      - name: side
+        image: busybox@sha256:abcd
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cfg
+data:
+  image: debug
+  file: |
+    a
+    b
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: demo
+spec:
+  ports:
+  - port: 80
+`)
+	var got []string
+	for _, g := range suggestFields(ms.Manifests, ms.Fields) {
+		got = append(got, fmt.Sprintf("%s=%s", g.Name, g.Pointer))
+	}
+	want := []string{
+		`app.image=Deployment/demo /spec/template/spec/containers/~{"name":"app"}/image/~(oci)/image`,
+		`app.tag=Deployment/demo /spec/template/spec/containers/~{"name":"app"}/image/~(oci)/tag`,
+		`env.FOO=Deployment/demo /spec/template/spec/containers/~{"name":"app"}/env/~{"name":"FOO"}/value`,
+		`limits.cpu=Deployment/demo /spec/template/spec/containers/~{"name":"app"}/resources/limits/cpu`,
+		`side.image=Deployment/demo /spec/template/spec/containers/~{"name":"side"}/image/~(oci)/image`,
+		`side.digest=Deployment/demo /spec/template/spec/containers/~{"name":"side"}/image/~(oci)/digest`,
+		`cfg.image=ConfigMap/cfg /data/image`,
+		`port=Service/demo /spec/ports/0/port`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestNameSuggestions(t *testing.T) {
+	gs := []fieldSuggestion{
+		{path: []string{"deployment", "a", "replicas"}, minLen: 1},
+		{path: []string{"deployment", "b", "replicas"}, minLen: 1},
+		{path: []string{"statefulset", "a", "replicas"}, minLen: 1},
+		{path: []string{"configmap", "c", "foo"}, minLen: 1},
+		{path: []string{"configmap", "c", "bar"}, minLen: 1},
+	}
+	nameSuggestions(gs, Fields{"foo": Field{Name: "foo"}})
+
+	var got []string
+	for _, g := range gs {
+		got = append(got, g.Name)
+	}
+	want := []string{"deployment.a.replicas", "b.replicas", "statefulset.a.replicas", "c.foo", "bar"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
@@ -6,27 +6,172 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
 	"sort"
+	"strconv"
 	"strings"
 
+	"filippo.io/age/armor"
+	yptr "github.com/vmware-labs/yaml-jsonpointer"
 	"gopkg.in/yaml.v3"
 	"knot8.io/pkg/lensed"
 )
 
 const (
-	annoDomain   = "knot8.io"
-	annoPrefix   = "field.knot8.io/"
-	originalAnno = "knot8.io/original"
+	annoDomain       = "knot8.io"
+	annoPrefix       = "field.knot8.io/"
+	sensitivePrefix  = "sensitive.knot8.io/"
+	deprecatedPrefix = "deprecated.knot8.io/"
+	originalAnno     = "knot8.io/original"
+
+	// redactedValue replaces the values of sensitive fields in the output.
+	redactedValue = "<redacted>"
 )
 
 type ManifestSet struct {
 	Manifests Manifests
 	Fields    Fields
+
+	// sidecars are files written along with the manifests (see encodeOriginalAnno).
+	sidecars []*shadowFile
+	// schema holds the resources of the out of band schema, if any.
+	schema Manifests
+	// strip causes the knot8 annotations to be removed from the output (see stripAnnotations).
+	strip bool
+	// showSecrets disables the redaction of the values of the sensitive fields in the diffs (see writeDiff).
+	showSecrets bool
+}
+
+// Commit saves changes made to the manifests, after finalizing them.
+func (ms *ManifestSet) Commit() error {
+	if err := ms.finalize(); err != nil {
+		return err
+	}
+	for _, s := range ms.sidecars {
+		if err := s.Commit(); err != nil {
+			return err
+		}
+	}
+	return ms.Manifests.Commit()
+}
+
+// Diff writes the unified diff of the changes made to the manifests, after finalizing them.
+// The values of the sensitive fields are redacted, unless showSecrets is set.
+func (ms *ManifestSet) Diff(w io.Writer) error {
+	if err := ms.finalize(); err != nil {
+		return err
+	}
+	return ms.writeDiff(w)
+}
+
+// finalize updates the checksums of the dependencies of the workloads and disables
+// the conditional resources whose fields evaluate to false.
+// If requested, the knot8 annotations are stripped last, once they are no longer needed.
+func (ms *ManifestSet) finalize() error {
+	if err := ms.updateChecksums(); err != nil {
+		return err
+	}
+	if err := ms.applyConditions(); err != nil {
+		return err
+	}
+	if !ms.strip {
+		return nil
+	}
+	done := map[*shadowFile]bool{}
+	for _, m := range ms.Manifests {
+		f := m.source.file
+		if done[f] {
+			continue
+		}
+		done[f] = true
+		b, err := stripAnnotations(f.buf)
+		if err != nil {
+			return err
+		}
+		f.buf = b
+	}
+	return nil
 }
 
 type Field struct {
 	Name     string
 	Pointers []Pointer
+
+	// Sensitive fields have their values redacted from the output.
+	// If nil, fields are sensitive if they point inside a Secret.
+	Sensitive *bool
+
+	// Generator is the spec used to generate random values for the field (see generateValue).
+	Generator string
+
+	// Immutable fields cannot be changed once they diverged from their original value.
+	Immutable bool
+
+	// ResourceName fields point to the name of a resource: setting them also updates
+	// the references to the resource (see Manifests.references).
+	ResourceName bool
+
+	// PodLabel fields point to a pod template label: setting them also updates
+	// the label selectors matching the label (see Manifests.references).
+	PodLabel bool
+
+	// Aliases are deprecated names of the field.
+	Aliases []string
+
+	// Description is taken from the comments attached to the field annotations.
+	Description string
+}
+
+// IsSensitive returns true if the field has been explicitly marked as sensitive,
+// if it points inside a Secret or if its value is encrypted,
+// unless explicitly marked as not sensitive.
+func (k Field) IsSensitive() bool {
+	if k.Sensitive != nil {
+		return *k.Sensitive
+	}
+	for _, p := range k.Pointers {
+		if p.Manifest.Kind == "Secret" || strings.Contains(p.Expr, ageLens) {
+			return true
+		}
+	}
+	return false
+}
+
+// ageLens is the path component of the pointers traversing the encrypting lens.
+const ageLens = "/~(age)"
+
+// baselineValue returns the value of the field as saved in the original values (see freeze).
+// Encrypted values are saved as the ciphertext found before the first encrypting lens,
+// so that they never appear in clear text.
+func (k Field) baselineValue() (string, error) {
+	p := k.Pointers[0]
+	i := strings.Index(p.Expr, ageLens)
+	if i < 0 {
+		values, err := k.GetAll()
+		if err != nil {
+			return "", err
+		}
+		return values[0].value, nil
+	}
+	r, err := lensed.Get(p.Manifest.source.file.buf, []string{Pointer{Expr: p.Expr[:i], Manifest: p.Manifest}.Abs()})
+	if err != nil {
+		return "", err
+	}
+	return string(r[0]), nil
+}
+
+// fromBaseline returns the value of the field saved as v in the original values,
+// decrypting it if it has been saved as ciphertext (see baselineValue).
+func (k Field) fromBaseline(v string) (string, error) {
+	i := strings.Index(k.Pointers[0].Expr, ageLens)
+	if i < 0 || !strings.HasPrefix(v, armor.Header) {
+		return v, nil
+	}
+	r, err := lensed.Get([]byte(v), []string{k.Pointers[0].Expr[i+1:]})
+	if err != nil {
+		return "", fmt.Errorf("decrypting the original value of field %q: %w", k.Name, err)
+	}
+	return string(r[0]), nil
 }
 
 type Pointer struct {
@@ -38,17 +183,79 @@ func (p Pointer) Abs() string {
 	return fmt.Sprintf("~(yamls)/%d%s", p.Manifest.source.streamPos, p.Expr)
 }
 
+// String returns the short name of the resource followed by the pointer expression.
+func (p Pointer) String() string {
+	return fmt.Sprintf("%s %s", p.Manifest.FQN().Short(), p.Expr)
+}
+
+// Position returns the file name, line and column of the node pointed by p.
+// For pointers traversing lenses, it's the position of the node holding the outermost lensed value.
+func (p Pointer) Position() (string, int, int) {
+	expr := p.Expr
+	if i := strings.Index(expr, "/~("); i >= 0 {
+		expr = expr[:i]
+	}
+	n, err := yptr.Find(&p.Manifest.raw, expr)
+	if err != nil {
+		n = p.Manifest.root()
+	}
+	return p.Manifest.source.file.name, n.Line, n.Column
+}
+
 type Fields map[string]Field
 
 func parseFields(manifests []*Manifest) (Fields, error) {
 	res := Fields{}
 	var errs []error
 	for _, m := range manifests {
+		comments := m.annotationComments()
 		for k, v := range m.Metadata.Annotations {
-			if strings.HasPrefix(k, annoPrefix) {
-				if err := res.addField(m, strings.TrimPrefix(k, annoPrefix), v); err != nil {
-					errs = append(errs, err)
+			var err error
+			switch {
+			case strings.HasPrefix(k, annoPrefix):
+				n := strings.TrimPrefix(k, annoPrefix)
+				err = res.addField(m, n, v)
+				if c := comments[k]; c != "" && res[n].Description == "" {
+					res.setAttr(n, func(f *Field) error {
+						f.Description = c
+						return nil
+					})
 				}
+			case strings.HasPrefix(k, sensitivePrefix):
+				err = res.setAttr(strings.TrimPrefix(k, sensitivePrefix), func(f *Field) error {
+					b, err := strconv.ParseBool(v)
+					f.Sensitive = &b
+					return err
+				})
+			case strings.HasPrefix(k, immutablePrefix):
+				err = res.setAttr(strings.TrimPrefix(k, immutablePrefix), func(f *Field) (err error) {
+					f.Immutable, err = strconv.ParseBool(v)
+					return
+				})
+			case strings.HasPrefix(k, resourceNamePrefix):
+				err = res.setAttr(strings.TrimPrefix(k, resourceNamePrefix), func(f *Field) (err error) {
+					f.ResourceName, err = strconv.ParseBool(v)
+					return
+				})
+			case strings.HasPrefix(k, podLabelPrefix):
+				err = res.setAttr(strings.TrimPrefix(k, podLabelPrefix), func(f *Field) (err error) {
+					f.PodLabel, err = strconv.ParseBool(v)
+					return
+				})
+			case strings.HasPrefix(k, deprecatedPrefix):
+				old := strings.TrimPrefix(k, deprecatedPrefix)
+				err = res.setAttr(v, func(f *Field) error {
+					f.Aliases = append(f.Aliases, old)
+					return nil
+				})
+			case strings.HasPrefix(k, generatePrefix):
+				err = res.setAttr(strings.TrimPrefix(k, generatePrefix), func(f *Field) error {
+					f.Generator = v
+					return nil
+				})
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("annotation %q of resource %s: %w", k, m.FQN(), err))
 			}
 		}
 	}
@@ -66,6 +273,70 @@ func (ks Fields) addField(m *Manifest, n, e string) error {
 	return nil
 }
 
+// setAttr sets attributes of a field, which may be defined later.
+func (ks Fields) setAttr(n string, set func(*Field) error) error {
+	k := ks[n]
+	k.Name = n
+	if err := set(&k); err != nil {
+		return err
+	}
+	ks[n] = k
+	return nil
+}
+
+// checkDefined checks that all the fields referenced by attribute annotations are defined.
+func (ks Fields) checkDefined() error {
+	var errs []error
+	for _, n := range ks.Names() {
+		if len(ks[n].Pointers) == 0 {
+			errs = append(errs, fmt.Errorf("annotations refer to undefined field %q", n))
+		}
+		for _, a := range ks[n].Aliases {
+			if _, found := ks[a]; found {
+				errs = append(errs, fmt.Errorf("deprecated field %q (replaced by %q) is still defined", a, n))
+			}
+		}
+	}
+	if errs != nil {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// canonical returns the name of the field that replaced the deprecated field name n,
+// or n itself if it's not deprecated.
+func (ks Fields) canonical(n string) (string, bool) {
+	if _, ok := ks[n]; ok {
+		return n, false
+	}
+	for _, k := range ks {
+		for _, a := range k.Aliases {
+			if a == n {
+				return k.Name, true
+			}
+		}
+	}
+	return n, false
+}
+
+// lookup returns the field named n, following deprecated field names.
+func (ks Fields) lookup(n string) (Field, error) {
+	c, _ := ks.canonical(n)
+	k, ok := ks[c]
+	if !ok {
+		return Field{}, fmt.Errorf("field %q not found", n)
+	}
+	return k, nil
+}
+
+// redact returns a placeholder instead of the value v of the field n, if the field is sensitive.
+func (ks Fields) redact(n, v string, showSecrets bool) string {
+	if !showSecrets && ks[n].IsSensitive() {
+		return redactedValue
+	}
+	return v
+}
+
 // Names returns a sorted slice of field names.
 func (ks Fields) Names() []string {
 	var names []string
@@ -108,6 +379,20 @@ func (ks Fields) Rebase(dst Manifests) error {
 func (ks Fields) MergeSchema(other Fields) {
 	for n := range other {
 		k := ks[n]
+		k.Name = n
+		if k.Sensitive == nil {
+			k.Sensitive = other[n].Sensitive
+		}
+		if k.Generator == "" {
+			k.Generator = other[n].Generator
+		}
+		k.Aliases = append(k.Aliases, other[n].Aliases...)
+		if k.Description == "" {
+			k.Description = other[n].Description
+		}
+		k.Immutable = k.Immutable || other[n].Immutable
+		k.ResourceName = k.ResourceName || other[n].ResourceName
+		k.PodLabel = k.PodLabel || other[n].PodLabel
 
 		ptrs := map[Pointer]struct{}{}
 		for _, p := range k.Pointers {
@@ -133,9 +418,9 @@ func checkFieldValues(values []FieldTarget) bool {
 }
 
 func (ks Fields) GetAll(n string) ([]FieldTarget, error) {
-	k, ok := ks[n]
-	if !ok {
-		return nil, fmt.Errorf("field %q not found", n)
+	k, err := ks.lookup(n)
+	if err != nil {
+		return nil, err
 	}
 	return k.GetAll()
 }
@@ -177,6 +462,11 @@ type EditBatch struct {
 	ks    Fields
 	edits map[*shadowFile][]lensed.Mapping
 
+	// manifests, if not nil, are scanned for references to renamed resources.
+	manifests Manifests
+	// policy, if not nil, is checked before accepting each edit.
+	policy *editPolicy
+
 	committed bool
 }
 
@@ -187,21 +477,43 @@ func (ks Fields) NewEditBatch() EditBatch {
 	}
 }
 
+// NewEditBatch returns an edit batch that also updates all the references
+// to the resource names and pod labels changed by the edited fields
+// (see Field.ResourceName and Field.PodLabel).
+func (ms *ManifestSet) NewEditBatch() EditBatch {
+	b := ms.Fields.NewEditBatch()
+	b.manifests = ms.Manifests
+	return b
+}
+
 func (b EditBatch) Set(n, v string) error {
 	if b.committed {
 		return fmt.Errorf("batch already committed")
 	}
 
-	k, ok := b.ks[n]
-	if !ok {
-		return fmt.Errorf("field %q not found", n)
+	k, err := b.ks.lookup(n)
+	if err != nil {
+		return err
+	}
+	if b.policy != nil {
+		if err := b.policy.check(b.ks, k, v); err != nil {
+			return err
+		}
 	}
 
 	var errs []error
 	for _, p := range k.Pointers {
-		file := p.Manifest.source.file
-		b.edits[file] = append(b.edits[file], lensed.Mapping{p.Abs(), v})
+		b.add(p, v)
 	}
+
+	refs, err := b.references(k, v)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, p := range refs {
+		b.add(p, v)
+	}
+
 	if errs != nil {
 		return errors.Join(errs...)
 	}
@@ -209,6 +521,51 @@ func (b EditBatch) Set(n, v string) error {
 	return nil
 }
 
+// add adds an edit to the batch, replacing any previous edit of the same location.
+func (b EditBatch) add(p Pointer, v string) {
+	file := p.Manifest.source.file
+	m := lensed.Mapping{Pointer: p.Abs(), Replacement: v}
+	for i, e := range b.edits[file] {
+		if e.Pointer == m.Pointer {
+			b.edits[file][i] = m
+			return
+		}
+	}
+	b.edits[file] = append(b.edits[file], m)
+}
+
+// references returns the pointers to the locations referring to the resource names
+// or pod labels pointed by the field k, which are not already pointed by k itself.
+func (b EditBatch) references(k Field, v string) ([]Pointer, error) {
+	if b.manifests == nil || !(k.ResourceName || k.PodLabel) {
+		return nil, nil
+	}
+
+	own := map[*yaml.Node]bool{}
+	for _, p := range k.Pointers {
+		if n, ok := p.resolveNode(); ok {
+			own[n] = true
+		}
+	}
+
+	var res []Pointer
+	for _, p := range k.Pointers {
+		r, err := lensed.Get(p.Manifest.source.file.buf, []string{p.Abs()})
+		if err != nil {
+			return nil, err
+		}
+		if old := string(r[0]); old != v {
+			for _, ref := range b.manifests.references(k, p, old) {
+				if !own[ref.node] {
+					own[ref.node] = true
+					res = append(res, ref.Pointer)
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
 // Commit performs the edits in bulk.
 func (b EditBatch) Commit() error {
 	var errs []error
@@ -226,15 +583,36 @@ func (b EditBatch) Commit() error {
 	return nil
 }
 
+// findOriginal returns the original values of the fields, merging the knot8.io/original annotations
+// of all the manifests (see freeze).
 func findOriginal(ms *ManifestSet) (map[string]string, error) {
+	res := map[string]string{}
 	for _, m := range ms.Manifests {
-		if o, ok := m.Metadata.Annotations[originalAnno]; ok {
-			var res map[string]string
-			if err := yaml.Unmarshal([]byte(o), &res); err != nil {
+		if _, ok := m.Metadata.Annotations[originalAnno]; ok {
+			o, err := ms.decodeOriginalAnno(m)
+			if err != nil {
+				return nil, err
+			}
+			var values map[string]string
+			if err := yaml.Unmarshal([]byte(o), &values); err != nil {
 				return nil, err
 			}
-			return res, nil
+			for n, v := range values {
+				if _, found := res[n]; !found {
+					res[n] = v
+				}
+			}
+		}
+	}
+	for n, v := range res {
+		k, ok := ms.Fields[n]
+		if !ok {
+			continue
+		}
+		var err error
+		if res[n], err = k.fromBaseline(v); err != nil {
+			return nil, err
 		}
 	}
-	return map[string]string{}, nil
+	return res, nil
 }
@@ -0,0 +1,218 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestIsSensitive(t *testing.T) {
+	ms, err := openFields([]string{copyTestdata(t, "secret1.yaml")}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		field string
+		want  bool
+	}{
+		{"password", true}, // points inside a Secret
+		{"user", false},    // points inside a Secret but explicitly marked as not sensitive
+		{"token", true},    // explicitly marked as sensitive
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			if got, want := ms.Fields[tc.field].IsSensitive(), tc.want; got != want {
+				t.Errorf("got: %v, want: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRedactValues(t *testing.T) {
+	ms, err := openFields([]string{copyTestdata(t, "secret1.yaml")}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		showSecrets bool
+		want        map[string]string
+	}{
+		{false, map[string]string{"password": redactedValue, "token": redactedValue, "user": "admin"}},
+		{true, map[string]string{"password": "hunter2", "token": "xyz", "user": "admin"}},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			b, err := renderValues(ms.Fields, tc.showSecrets, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]string
+			if err := yaml.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %q, want: %q", got, tc.want)
+			}
+
+			d, err := diff(ms)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := ms.Fields.redact("token", d["token"], tc.showSecrets), tc.want["token"]; got != want {
+				t.Errorf("got: %q, want: %q", got, want)
+			}
+		})
+	}
+
+	o, err := redactOriginalAnnoBody("password: hunter2\nuser: admin\n", ms.Fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := o, "password: "+redactedValue+"\nuser: admin\n"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestCheckFieldsRedacted(t *testing.T) {
+	ms := parseTestManifestSet(t, `apiVersion: v1
+kind: Secret
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/password: /stringData/password
+stringData:
+  password: hunter2
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/password: /data/password
+data:
+  password: hunter3
+`)
+	testCases := []struct {
+		showSecrets bool
+		want        bool // whether the values appear in the error
+	}{
+		{false, false},
+		{true, true},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			err := checkFields(ms.Fields, tc.showSecrets)
+			if !isNotUniqueValueError(err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got, want := strings.Contains(err.Error(), "hunter2"), tc.want; got != want {
+				t.Errorf("got: %v, want: %v (%v)", got, want, err)
+			}
+			if got, want := strings.Contains(err.Error(), redactedValue), !tc.want; got != want {
+				t.Errorf("got: %v, want: %v (%v)", got, want, err)
+			}
+		})
+	}
+}
+
+const deprecatedTestManifest = `apiVersion: v1
+kind: Secret
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/db.password: /stringData/password
+    generate.knot8.io/db.password: hex:8
+    deprecated.knot8.io/password: db.password
+    deprecated.knot8.io/pass: db.password
+stringData:
+  password: ""
+`
+
+func TestCanonical(t *testing.T) {
+	ms := parseTestManifestSet(t, deprecatedTestManifest)
+	if got, want := ms.Fields["db.password"].Aliases, []string{"pass", "password"}; !reflect.DeepEqual(sorted(got), want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	testCases := []struct {
+		name       string
+		want       string
+		deprecated bool
+	}{
+		{"db.password", "db.password", false},
+		{"password", "db.password", true},
+		{"pass", "db.password", true},
+		{"other", "other", false},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			got, deprecated := ms.Fields.canonical(tc.name)
+			if got != tc.want || deprecated != tc.deprecated {
+				t.Errorf("got: %q, %v, want: %q, %v", got, deprecated, tc.want, tc.deprecated)
+			}
+		})
+	}
+
+	b := ms.NewEditBatch()
+	if err := b.Set("pass", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ms.Fields.GetValue("db.password"); err != nil {
+		t.Fatal(err)
+	} else if want := "secret"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestCheckDefinedDeprecated(t *testing.T) {
+	ms := parseTestManifestSet(t, strings.Replace(deprecatedTestManifest, "    deprecated.knot8.io/pass:", "    field.knot8.io/pass: /stringData/password\n    deprecated.knot8.io/pass:", 1))
+	if err := ms.Fields.checkDefined(); err == nil {
+		t.Error("expecting error")
+	}
+}
+
+// TestSetGenerateDeprecated checks that a field set explicitly via a deprecated name is not generated.
+func TestSetGenerateDeprecated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.yaml")
+	if err := os.WriteFile(path, []byte(deprecatedTestManifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := SetCmd{
+		CommonFlags: CommonFlags{Paths: []string{path}},
+		Values:      []Setter{{"password", "secret"}},
+		Generate:    true,
+	}
+	if err := s.Run(&Context{}); err != nil {
+		t.Fatal(err)
+	}
+	ms, err := openFields([]string{path}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ms.Fields.GetValue("db.password"); err != nil {
+		t.Fatal(err)
+	} else if want := "secret"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+	if got := ms.generated(); len(got) != 0 {
+		t.Errorf("got: %v, want none", got)
+	}
+}
+
+func sorted(s []string) []string {
+	r := append([]string{}, s...)
+	sort.Strings(r)
+	return r
+}
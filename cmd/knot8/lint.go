@@ -0,0 +1,554 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+	"knot8.io/pkg/lensed"
+)
+
+type LintCmd struct {
+	CommonFlags
+	CommonSchemaFlags
+	CommonPolicyFlags
+	SecretsFlags
+
+	From             []string `name:"from" type:"file" help:"Check the field names used in one or more values files."`
+	FailOnDeprecated bool     `name:"fail-on-deprecated" help:"Fail if the values files use deprecated field names."`
+	Enable           []string `name:"enable" help:"Run only the given rules."`
+	Disable          []string `name:"disable" help:"Skip the given rules."`
+	Format           string   `name:"format" enum:"text,json,sarif" default:"text" help:"Output format (text, json, sarif)."`
+	ListRules        bool     `name:"list-rules" help:"List the available rules and exit."`
+	Fix              bool     `name:"fix" help:"Reconcile the divergent values pointed by each field before checking."`
+	Prefer           string   `name:"prefer" default:"majority" help:"Value chosen by --fix: majority, original, or the name of the resource (Kind/name) or file holding the value."`
+}
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// A lintRule checks a manifest set and reports its findings.
+type lintRule struct {
+	ID          string
+	Severity    string
+	Description string
+	Check       func(c *lintContext) ([]lintFinding, error)
+}
+
+type lintContext struct {
+	ms          *ManifestSet
+	policy      *Policy
+	from        []string
+	showSecrets bool
+}
+
+// A lintFinding is a problem found by a lint rule, with the position of the offending text.
+type lintFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+}
+
+// lintRules are run in order by the lint command.
+var lintRules = []lintRule{
+	{"non-unique-value", severityError, "All the values pointed by a field must be the same.", lintNonUniqueValues},
+	{"unresolved-pointer", severityError, "Field pointers must resolve to a value.", lintUnresolvedPointers},
+	{"non-scalar-target", severityError, "Fields must point to scalar values.", lintNonScalarTargets},
+	{"unmatched-schema-resource", severityWarning, "Schema resources must match a resource in the manifests.", lintUnmatchedSchemaResources},
+	{"duplicate-annotation", severityWarning, "knot8 annotations must not be defined both inline and in the schema with different values.", lintDuplicateAnnotations},
+	{"duplicate-target", severityWarning, "A value should be exposed by only one field.", lintDuplicateTargets},
+	{"policy-violation", severityError, "Fields that the policy forbids changing must hold their original values.", lintPolicyViolations},
+	{"deprecated-name", severityWarning, "Values files should not use deprecated field names.", lintDeprecatedNames},
+	{"dangling-reference", severityWarning, "Referenced resources should be defined in the manifest set.", lintDanglingReferences},
+	{"annotations-size", severityWarning, "Annotations should not approach the Kubernetes size limit.", lintAnnotationsSize},
+}
+
+func (s *LintCmd) Run(ctx *Context) error {
+	if s.ListRules {
+		for _, r := range lintRules {
+			fmt.Printf("%-26s %-8s %s\n", r.ID, r.Severity, r.Description)
+		}
+		return nil
+	}
+
+	rules, err := selectLintRules(s.Enable, s.Disable)
+	if err != nil {
+		return err
+	}
+
+	policy, err := s.CommonPolicyFlags.load()
+	if err != nil {
+		return err
+	}
+	if s.Fix {
+		if err := s.fix(policy); err != nil {
+			return err
+		}
+	}
+
+	manifestSet, err := openFields(s.Paths, s.Schema)
+	if err != nil && !isNotUniqueValueError(err) {
+		return err
+	}
+
+	from := s.From
+	if _, err := os.Stat(Knot8file); err == nil {
+		from = append([]string{Knot8file}, from...)
+	}
+	c := &lintContext{ms: manifestSet, policy: policy, from: from, showSecrets: s.ShowSecrets}
+
+	severity := map[string]string{}
+	if s.FailOnDeprecated {
+		severity["deprecated-name"] = severityError
+	}
+
+	findings, err := runLintRules(c, rules, severity)
+	if err != nil {
+		return err
+	}
+
+	switch s.Format {
+	case "json":
+		err = renderLintJSON(os.Stdout, findings)
+	case "sarif":
+		err = renderLintSARIF(os.Stdout, rules, findings)
+	default:
+		renderLintText(os.Stdout, findings)
+	}
+	if err != nil {
+		return err
+	}
+
+	errs := 0
+	for _, f := range findings {
+		if f.Severity == severityError {
+			errs++
+		}
+	}
+	if errs > 0 {
+		return fmt.Errorf("lint errors found: %d", errs)
+	}
+	return nil
+}
+
+// fix reconciles the divergent field values in place, as allowed by the policy.
+// Each change is reported to stderr, keeping stdout for the findings.
+func (s *LintCmd) fix(policy *Policy) error {
+	for _, p := range s.Paths {
+		if p == "-" {
+			return fmt.Errorf("--fix cannot be used with the standard input")
+		}
+	}
+	if len(s.Paths) == 0 {
+		return fmt.Errorf("--fix requires the manifest files to be passed with -f")
+	}
+
+	manifestSet, err := openFields(s.Paths, s.Schema)
+	if err != nil && !isNotUniqueValueError(err) {
+		return err
+	}
+	batch := manifestSet.NewEditBatch()
+	if err := batch.Enforce(manifestSet, policy); err != nil {
+		return err
+	}
+	fixes, err := reconcileFields(manifestSet, batch, s.Prefer)
+	if err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	renderFixes(os.Stderr, manifestSet.Fields, fixes, s.ShowSecrets)
+	return manifestSet.Commit()
+}
+
+// selectLintRules returns the rules listed in enable (or all the rules if empty), except those listed in disable.
+func selectLintRules(enable, disable []string) ([]lintRule, error) {
+	known := map[string]bool{}
+	for _, r := range lintRules {
+		known[r.ID] = true
+	}
+	set := func(ids []string) (map[string]bool, error) {
+		res := map[string]bool{}
+		for _, id := range ids {
+			if !known[id] {
+				return nil, fmt.Errorf("unknown lint rule %q", id)
+			}
+			res[id] = true
+		}
+		return res, nil
+	}
+	en, err := set(enable)
+	if err != nil {
+		return nil, err
+	}
+	dis, err := set(disable)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []lintRule
+	for _, r := range lintRules {
+		if (len(en) == 0 || en[r.ID]) && !dis[r.ID] {
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+// runLintRules runs the rules, overriding their severity with the severity map.
+func runLintRules(c *lintContext, rules []lintRule, severity map[string]string) ([]lintFinding, error) {
+	var res []lintFinding
+	for _, r := range rules {
+		fs, err := r.Check(c)
+		if err != nil {
+			return nil, fmt.Errorf("lint rule %q: %w", r.ID, err)
+		}
+		sev := r.Severity
+		if s, ok := severity[r.ID]; ok {
+			sev = s
+		}
+		for _, f := range fs {
+			f.Rule, f.Severity = r.ID, sev
+			res = append(res, f)
+		}
+	}
+	return res, nil
+}
+
+func findingAt(file string, line, col int, format string, args ...interface{}) lintFinding {
+	return lintFinding{Message: fmt.Sprintf(format, args...), File: file, Line: line, Column: col}
+}
+
+func manifestFinding(m *Manifest, format string, args ...interface{}) lintFinding {
+	n := m.root()
+	return findingAt(m.source.file.name, n.Line, n.Column, format, args...)
+}
+
+func pointerFinding(p Pointer, format string, args ...interface{}) lintFinding {
+	file, line, col := p.Position()
+	return findingAt(file, line, col, format, args...)
+}
+
+// annotationFinding returns a finding located at the annotation key of the manifest m,
+// looking for it in the schema if it's not defined inline.
+func annotationFinding(ms *ManifestSet, m *Manifest, key string, format string, args ...interface{}) lintFinding {
+	for _, c := range append(Manifests{m}, ms.schema...) {
+		if c != m && !c.matches(m) {
+			continue
+		}
+		if n, ok := annotationNode(c, key); ok {
+			return findingAt(c.source.file.name, n.Line, n.Column, format, args...)
+		}
+	}
+	return manifestFinding(m, format, args...)
+}
+
+// annotationNode returns the node of the value of the annotation key, as found in the source of the manifest.
+func annotationNode(m *Manifest, key string) (*yaml.Node, bool) {
+	n, ok := (Pointer{Expr: "/metadata/annotations/" + escapePointerToken(key), Manifest: m}).resolveNode()
+	return n, ok && n.Kind == yaml.ScalarNode
+}
+
+func lintNonUniqueValues(c *lintContext) ([]lintFinding, error) {
+	var res []lintFinding
+	fields := c.ms.Fields
+	for _, n := range fields.Names() {
+		values, err := fields[n].GetAll()
+		if err != nil || checkFieldValues(values) {
+			// unresolved pointers are reported by their own rule.
+			continue
+		}
+		var vs []string
+		for _, v := range values {
+			vs = append(vs, fields.redact(n, v.value, c.showSecrets))
+		}
+		res = append(res, pointerFinding(values[0].ptr, "values pointed by field %q are not unique (%q)", n, vs))
+	}
+	return res, nil
+}
+
+func lintUnresolvedPointers(c *lintContext) ([]lintFinding, error) {
+	var res []lintFinding
+	for _, n := range c.ms.Fields.Names() {
+		for _, p := range c.ms.Fields[n].Pointers {
+			if node, ok := p.resolveNode(); ok && node.Kind != yaml.ScalarNode {
+				// reported by the non-scalar-target rule.
+				continue
+			}
+			if _, err := lensed.Get(p.Manifest.source.file.buf, []string{p.Abs()}); err != nil {
+				res = append(res, annotationFinding(c.ms, p.Manifest, annoPrefix+n, "pointer %q of field %q does not resolve in %s: %v", p.Expr, n, p.Manifest.FQN().Short(), err))
+			}
+		}
+	}
+	return res, nil
+}
+
+func lintNonScalarTargets(c *lintContext) ([]lintFinding, error) {
+	kinds := map[yaml.Kind]string{yaml.MappingNode: "mapping", yaml.SequenceNode: "sequence", yaml.AliasNode: "alias"}
+
+	var res []lintFinding
+	for _, n := range c.ms.Fields.Names() {
+		for _, p := range c.ms.Fields[n].Pointers {
+			if node, ok := p.resolveNode(); ok && node.Kind != yaml.ScalarNode {
+				file, _, _ := p.Position()
+				res = append(res, findingAt(file, node.Line, node.Column, "field %q points to a %s node (%s)", n, kinds[node.Kind], p))
+			}
+		}
+	}
+	return res, nil
+}
+
+func lintUnmatchedSchemaResources(c *lintContext) ([]lintFinding, error) {
+	var res []lintFinding
+	for _, m := range c.ms.schema {
+		found := false
+		for _, o := range c.ms.Manifests {
+			found = found || m.matches(o)
+		}
+		if !found {
+			res = append(res, manifestFinding(m, "schema resource %s doesn't match any resource in the manifests", m.FQN().Short()))
+		}
+	}
+	return res, nil
+}
+
+func lintDuplicateAnnotations(c *lintContext) ([]lintFinding, error) {
+	var res []lintFinding
+	for _, s := range c.ms.schema {
+		var keys []string
+		for k := range s.Metadata.Annotations {
+			if isOurAnnotation(k) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, m := range c.ms.Manifests {
+			if !s.matches(m) {
+				continue
+			}
+			for _, k := range keys {
+				if n, ok := annotationNode(m, k); ok && n.Value != s.Metadata.Annotations[k] {
+					sn, _ := annotationNode(s, k)
+					f := manifestFinding(s, "")
+					if sn != nil {
+						f = findingAt(s.source.file.name, sn.Line, sn.Column, "")
+					}
+					f.Message = fmt.Sprintf("annotation %q of %s is defined both inline (%q) and in the schema (%q); the schema takes precedence",
+						k, m.FQN().Short(), n.Value, s.Metadata.Annotations[k])
+					res = append(res, f)
+				}
+			}
+		}
+	}
+	return res, nil
+}
+
+func lintDuplicateTargets(c *lintContext) ([]lintFinding, error) {
+	type target struct {
+		m    *Manifest
+		node *yaml.Node
+		expr string
+	}
+	var (
+		order []target
+		first = map[target]Pointer{}
+		names = map[target][]string{}
+	)
+	for _, n := range c.ms.Fields.Names() {
+		for _, p := range c.ms.Fields[n].Pointers {
+			t := target{m: p.Manifest, expr: p.Expr}
+			if node, ok := p.resolveNode(); ok {
+				t = target{m: p.Manifest, node: node}
+			}
+			if _, found := first[t]; !found {
+				order = append(order, t)
+				first[t] = p
+			}
+			if l := names[t]; len(l) == 0 || l[len(l)-1] != n {
+				names[t] = append(l, n)
+			}
+		}
+	}
+
+	var res []lintFinding
+	for _, t := range order {
+		if len(names[t]) > 1 {
+			res = append(res, pointerFinding(first[t], "fields %q point to the same value (%s)", names[t], first[t]))
+		}
+	}
+	return res, nil
+}
+
+func lintPolicyViolations(c *lintContext) ([]lintFinding, error) {
+	names, err := policyViolations(c.ms, c.policy)
+	if err != nil {
+		return nil, err
+	}
+	var res []lintFinding
+	for _, n := range names {
+		res = append(res, pointerFinding(c.ms.Fields[n].Pointers[0], "field %q has been changed from its original value, but policy %q forbids changing it", n, c.policy.name))
+	}
+	return res, nil
+}
+
+func lintDeprecatedNames(c *lintContext) ([]lintFinding, error) {
+	var res []lintFinding
+	for _, f := range c.from {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var doc yaml.Node
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			return nil, fmt.Errorf("parsing %q: %w", f, err)
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		m := doc.Content[0]
+		var keys []*yaml.Node
+		for i := 0; i+1 < len(m.Content); i += 2 {
+			if k := m.Content[i].Value; k == "apiVersion" || k == "kind" {
+				// not a values file (see parseSimplifiedValues)
+				keys = nil
+				break
+			}
+			keys = append(keys, m.Content[i])
+		}
+		for _, k := range keys {
+			if n, deprecated := c.ms.Fields.canonical(k.Value); deprecated {
+				res = append(res, findingAt(f, k.Line, k.Column, "field %q is deprecated, use %q instead", k.Value, n))
+			}
+		}
+	}
+	return res, nil
+}
+
+func lintDanglingReferences(c *lintContext) ([]lintFinding, error) {
+	var res []lintFinding
+	for _, d := range c.ms.Manifests.danglingReferences() {
+		res = append(res, findingAt(d.Manifest.source.file.name, d.Node.Line, d.Node.Column, "%s", d))
+	}
+	return res, nil
+}
+
+func lintAnnotationsSize(c *lintContext) ([]lintFinding, error) {
+	var res []lintFinding
+	for _, m := range c.ms.Manifests {
+		n, err := annotationsSize(m)
+		if err != nil {
+			return nil, err
+		}
+		if n > annotationsSizeLimit*3/4 {
+			res = append(res, manifestFinding(m, "annotations of %s take %d bytes, close to the %d bytes limit; consider storing the original values with freeze --baseline=%s or --baseline=%s",
+				m.FQN().Short(), n, annotationsSizeLimit, baselineGzip, baselineFile))
+		}
+	}
+	return res, nil
+}
+
+func renderLintText(w io.Writer, findings []lintFinding) {
+	for _, f := range findings {
+		if f.File != "" {
+			fmt.Fprintf(w, "%s:%d:%d: ", f.File, f.Line, f.Column)
+		}
+		fmt.Fprintf(w, "%s: %s [%s]\n", f.Severity, f.Message, f.Rule)
+	}
+}
+
+func renderLintJSON(w io.Writer, findings []lintFinding) error {
+	if findings == nil {
+		findings = []lintFinding{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(findings)
+}
+
+// renderLintSARIF renders the findings in the Static Analysis Results Interchange Format (SARIF) 2.1.0.
+func renderLintSARIF(w io.Writer, rules []lintRule, findings []lintFinding) error {
+	type text struct {
+		Text string `json:"text"`
+	}
+	type rule struct {
+		ID                   string `json:"id"`
+		ShortDescription     text   `json:"shortDescription"`
+		DefaultConfiguration struct {
+			Level string `json:"level"`
+		} `json:"defaultConfiguration"`
+	}
+	type region struct {
+		StartLine   int `json:"startLine,omitempty"`
+		StartColumn int `json:"startColumn,omitempty"`
+	}
+	type location struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+			Region region `json:"region"`
+		} `json:"physicalLocation"`
+	}
+	type result struct {
+		RuleID    string     `json:"ruleId"`
+		Level     string     `json:"level"`
+		Message   text       `json:"message"`
+		Locations []location `json:"locations,omitempty"`
+	}
+	type driver struct {
+		Name           string `json:"name"`
+		InformationURI string `json:"informationUri"`
+		Rules          []rule `json:"rules"`
+	}
+	type run struct {
+		Tool struct {
+			Driver driver `json:"driver"`
+		} `json:"tool"`
+		Results []result `json:"results"`
+	}
+	type log struct {
+		Version string `json:"version"`
+		Schema  string `json:"$schema"`
+		Runs    []run  `json:"runs"`
+	}
+
+	var r run
+	r.Tool.Driver = driver{Name: "knot8", InformationURI: "https://knot8.io"}
+	for _, lr := range rules {
+		sr := rule{ID: lr.ID, ShortDescription: text{lr.Description}}
+		sr.DefaultConfiguration.Level = lr.Severity
+		r.Tool.Driver.Rules = append(r.Tool.Driver.Rules, sr)
+	}
+	r.Results = []result{}
+	for _, f := range findings {
+		res := result{RuleID: f.Rule, Level: f.Severity, Message: text{f.Message}}
+		if f.File != "" {
+			var l location
+			l.PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(f.File)
+			l.PhysicalLocation.Region = region{StartLine: f.Line, StartColumn: f.Column}
+			res.Locations = []location{l}
+		}
+		r.Results = append(r.Results, res)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []run{r},
+	})
+}
@@ -0,0 +1,346 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLintRules(t *testing.T) {
+	ms := parseTestManifestSet(t, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/a: /data/a
+    field.knot8.io/b: /data/a
+    field.knot8.io/c: /data/nope
+    field.knot8.io/d: /data
+data:
+  a: "1"
+`)
+	rules, err := selectLintRules(nil, []string{"deprecated-name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings, err := runLintRules(&lintContext{ms: ms}, rules, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, f := range findings {
+		got = append(got, fmt.Sprintf("%s:%d:%d %s %s", f.File, f.Line, f.Column, f.Severity, f.Rule))
+	}
+	want := []string{
+		"test.yaml:8:23 error unresolved-pointer",
+		"test.yaml:11:3 error non-scalar-target",
+		"test.yaml:11:6 warning duplicate-target",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	if _, err := selectLintRules([]string{"bogus"}, nil); err == nil {
+		t.Errorf("expecting error for unknown rule")
+	}
+}
+
+func TestLintRuleFindings(t *testing.T) {
+	testCases := []struct {
+		rule   string
+		src    string
+		schema string
+		policy string
+		values string
+		want   []string
+	}{
+		{
+			rule: "non-unique-value",
+			src: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/a: /data/a
+    field.knot8.io/b: /data/b
+    field.knot8.io/c: /data/c
+data:
+  a: "1"
+  b: "1"
+  c: "2"
+`,
+			schema: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/a: /data/c
+`,
+			want: []string{"test.yaml:10:6 error non-unique-value"},
+		},
+		{
+			rule: "unmatched-schema-resource",
+			src: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+`,
+			schema: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other
+  annotations:
+    field.knot8.io/a: /data/a
+`,
+			want: []string{"Knot8file:1:1 warning unmatched-schema-resource"},
+		},
+		{
+			rule: "duplicate-annotation",
+			src: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/a: /data/a
+data:
+  a: "1"
+  b: "1"
+`,
+			schema: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/a: /data/b
+`,
+			want: []string{"Knot8file:6:23 warning duplicate-annotation"},
+		},
+		{
+			rule: "policy-violation",
+			src: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/a: /data/a
+    field.knot8.io/b: /data/b
+    knot8.io/original: |
+      a: "1"
+      b: "1"
+data:
+  a: "2"
+  b: "2"
+`,
+			policy: "deny:\n- a\n",
+			want:   []string{"test.yaml:12:6 error policy-violation"},
+		},
+		{
+			rule: "deprecated-name",
+			src: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/a: /data/a
+    deprecated.knot8.io/old: a
+data:
+  a: "1"
+`,
+			values: "a: \"2\"\nold: \"3\"\n",
+			want:   []string{"values.yaml:2:1 warning deprecated-name"},
+		},
+		{
+			rule: "dangling-reference",
+			src: `apiVersion: v1
+kind: Pod
+metadata:
+  name: demo
+spec:
+  serviceAccountName: default
+  volumes:
+  - name: config
+    configMap:
+      name: missing
+  - name: secret
+    secret:
+      secretName: demo
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: demo
+`,
+			want: []string{"test.yaml:10:13 warning dangling-reference"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.rule, func(t *testing.T) {
+			dir := t.TempDir()
+			write := func(name, src string) string {
+				t.Helper()
+				if src == "" {
+					return ""
+				}
+				p := filepath.Join(dir, name)
+				if err := os.WriteFile(p, []byte(src), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return p
+			}
+			ms, err := openFields([]string{write("test.yaml", tc.src)}, write(Knot8file, tc.schema))
+			if err != nil && !isNotUniqueValueError(err) {
+				t.Fatal(err)
+			}
+			c := &lintContext{ms: ms}
+			if p := write(Knot8policy, tc.policy); p != "" {
+				if c.policy, err = loadPolicy(p); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if p := write("values.yaml", tc.values); p != "" {
+				c.from = []string{p}
+			}
+
+			rules, err := selectLintRules([]string{tc.rule}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			findings, err := runLintRules(c, rules, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range findings {
+				got = append(got, fmt.Sprintf("%s:%d:%d %s %s", filepath.Base(f.File), f.Line, f.Column, f.Severity, f.Rule))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got: %q, want: %q", got, tc.want)
+			}
+		})
+	}
+}
+
+var renderTestFindings = []lintFinding{
+	{Rule: "unresolved-pointer", Severity: severityError, Message: "pointer does not resolve", File: "test.yaml", Line: 8, Column: 23},
+	{Rule: "duplicate-target", Severity: severityWarning, Message: "fields point to the same value"},
+}
+
+func TestRenderLintJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := renderLintJSON(&buf, renderTestFindings); err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+  {
+    "rule": "unresolved-pointer",
+    "severity": "error",
+    "message": "pointer does not resolve",
+    "file": "test.yaml",
+    "line": 8,
+    "column": 23
+  },
+  {
+    "rule": "duplicate-target",
+    "severity": "warning",
+    "message": "fields point to the same value"
+  }
+]
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+
+	buf.Reset()
+	if err := renderLintJSON(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "[]\n"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestRenderLintSARIF(t *testing.T) {
+	rules, err := selectLintRules([]string{"unresolved-pointer", "duplicate-target"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := renderLintSARIF(&buf, rules, renderTestFindings); err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "version": "2.1.0",
+  "$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+  "runs": [
+    {
+      "tool": {
+        "driver": {
+          "name": "knot8",
+          "informationUri": "https://knot8.io",
+          "rules": [
+            {
+              "id": "unresolved-pointer",
+              "shortDescription": {
+                "text": "Field pointers must resolve to a value."
+              },
+              "defaultConfiguration": {
+                "level": "error"
+              }
+            },
+            {
+              "id": "duplicate-target",
+              "shortDescription": {
+                "text": "A value should be exposed by only one field."
+              },
+              "defaultConfiguration": {
+                "level": "warning"
+              }
+            }
+          ]
+        }
+      },
+      "results": [
+        {
+          "ruleId": "unresolved-pointer",
+          "level": "error",
+          "message": {
+            "text": "pointer does not resolve"
+          },
+          "locations": [
+            {
+              "physicalLocation": {
+                "artifactLocation": {
+                  "uri": "test.yaml"
+                },
+                "region": {
+                  "startLine": 8,
+                  "startColumn": 23
+                }
+              }
+            }
+          ]
+        },
+        {
+          "ruleId": "duplicate-target",
+          "level": "warning",
+          "message": {
+            "text": "fields point to the same value"
+          }
+        }
+      ]
+    }
+  ]
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+}
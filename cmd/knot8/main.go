@@ -13,7 +13,6 @@ import (
 	"github.com/alecthomas/kong"
 	"github.com/hashicorp/go-getter"
 	"gopkg.in/yaml.v3"
-	"knot8.io/pkg/lensed"
 )
 
 const (
@@ -24,13 +23,23 @@ type Context struct {
 }
 
 var cli struct {
-	Set    SetCmd    `cmd:"" help:"Set a field value."`
-	Cat    CatCmd    `cmd:"" help:"Like set but always output to stdout"`
-	Values ValuesCmd `cmd:"" help:"Show available fields."`
-	Diff   DiffCmd   `cmd:"" help:"Show the values different from the original."`
-	Pull   PullCmd   `cmd:"" help:"Pull and merge a new version from upstream."`
-	Lint   LintCmd   `cmd:"" help:"Check that the manifests follow the knot8 rules."`
-	Schema SchemaCmd `cmd:"" help:"Emit the schema. Can also be used to generate a Knot8file from an inline annotated manifest set."`
+	Set         SetCmd         `cmd:"" help:"Set a field value."`
+	Cat         CatCmd         `cmd:"" help:"Like set but always output to stdout. Resources disabled via knot8.io/enabled-by are omitted."`
+	Values      ValuesCmd      `cmd:"" help:"Show available fields."`
+	Diff        DiffCmd        `cmd:"" help:"Show the values different from the original."`
+	Pull        PullCmd        `cmd:"" help:"Pull and merge a new version from upstream."`
+	Lint        LintCmd        `cmd:"" help:"Check that the manifests follow the knot8 rules."`
+	Schema      SchemaCmd      `cmd:"" help:"Emit the schema. Can also be used to generate a Knot8file from an inline annotated manifest set."`
+	Docs        DocsCmd        `cmd:"" help:"Render the documentation of the fields."`
+	Compare     CompareCmd     `cmd:"" help:"Show the changes in the fields between two versions."`
+	Check       CheckCmd       `cmd:"" help:"Check that the fields hold the expected values."`
+	Reset       ResetCmd       `cmd:"" help:"Restore the original values of the fields."`
+	Freeze      FreezeCmd      `cmd:"" help:"Save the current values of the fields to knot8.io/original."`
+	Explain     ExplainCmd     `cmd:"" help:"Show where each field points to."`
+	Pointer     PointerCmd     `cmd:"" help:"Compute the pointer to the node at a file position."`
+	Annotate    AnnotateCmd    `cmd:"" help:"Add field definitions to a resource."`
+	Init        InitCmd        `cmd:"" help:"Suggest fields for the common tunables of un-annotated manifests."`
+	RenameField RenameFieldCmd `cmd:"" name:"rename-field" help:"Rename a field in the manifests, the schema and the values files."`
 
 	Version kong.VersionFlag `name:"version" help:"Print version information and quit"`
 }
@@ -39,6 +48,32 @@ type CommonFlags struct {
 	Paths []string `name:"filename" short:"f" help:"Filenames or directories containing k8s manifests with fields." type:"file"`
 }
 
+type CommonPolicyFlags struct {
+	Policy string `name:"policy" type:"existingfile" help:"File restricting which fields can be changed. Defaults to Knot8policy, if present in the current directory."`
+}
+
+func (c *CommonPolicyFlags) AfterApply() error {
+	if c.Policy == "" {
+		_, err := os.Stat(Knot8policy)
+		if err == nil {
+			c.Policy = Knot8policy
+		}
+	}
+	return nil
+}
+
+// load returns the policy, or nil if no policy has been configured.
+func (c *CommonPolicyFlags) load() (*Policy, error) {
+	if c.Policy == "" {
+		return nil, nil
+	}
+	return loadPolicy(c.Policy)
+}
+
+type SecretsFlags struct {
+	ShowSecrets bool `name:"show-secrets" help:"Show the values of sensitive fields instead of redacting them."`
+}
+
 type CommonSchemaFlags struct {
 	Schema string `name:"schema" help:"File containing field definitions. Used to augment the field definitions present inline in the resource annotations. The file format mirrors the format of real K8s resources, but shall only contain apiVersion,kind,metadata name, namespace and field annotations."`
 }
@@ -80,21 +115,32 @@ func (s *Setter) UnmarshalText(in []byte) error {
 
 type CatCmd struct {
 	SetCmd
+
+	Strip bool `name:"strip" help:"Remove the knot8 annotations from the output."`
 }
 
 func (c *CatCmd) Run(ctx *Context) error {
 	c.Stdout = true
+	c.strip = c.Strip
 	return c.SetCmd.Run(ctx)
 }
 
 type SetCmd struct {
 	CommonFlags
 	CommonSchemaFlags
-
-	Values []Setter `optional:"" arg:"" help:"Value to set. Format: field=value or field=@filename, where a leading @ can be escaped with a backslash."`
-	From   []string `name:"from" type:"file" help:"Read values from one or more files."`
-	Freeze bool     `name:"freeze" help:"Save current values to knot8.io/original."`
-	Stdout bool     `name:"stdout" help:"Output to stdout and never update files in-place"`
+	CommonPolicyFlags
+	SecretsFlags
+
+	Values   []Setter `optional:"" arg:"" help:"Value to set. Format: field=value or field=@filename, where a leading @ can be escaped with a backslash."`
+	From     []string `name:"from" type:"file" help:"Read values from one or more files."`
+	Freeze   bool     `name:"freeze" help:"Save current values to knot8.io/original."`
+	Baseline string   `name:"baseline" enum:",inline,gzip,file" default:"" help:"How --freeze stores the original values: inline, gzip (compressed annotation) or file (sidecar file). Defaults to the current form, or inline."`
+	Stdout   bool     `name:"stdout" help:"Output to stdout and never update files in-place"`
+	Generate bool     `name:"generate" help:"Generate random values for the fields that declare a generator and still hold their placeholder (original) value."`
+	Diff     bool     `name:"diff" help:"Show a unified diff of the changes instead of writing them."`
+
+	// strip is set by the cat command, see ManifestSet.strip.
+	strip bool
 }
 
 func (s *SetCmd) Run(ctx *Context) error {
@@ -109,6 +155,9 @@ func (s *SetCmd) Run(ctx *Context) error {
 		return err
 	}
 
+	manifestSet.strip = s.strip
+	manifestSet.showSecrets = s.ShowSecrets
+
 	// if outputing to stdout instead of inline (either via --stdout, or because of the cat command),
 	// rename all filenames to "-" causing them to be treated as stdio upon commit.
 	if s.Stdout {
@@ -126,27 +175,60 @@ func (s *SetCmd) Run(ctx *Context) error {
 		values = append(fromValues, values...)
 	}
 
-	batch := manifestSet.Fields.NewEditBatch()
+	policy, err := s.CommonPolicyFlags.load()
+	if err != nil {
+		return err
+	}
+	batch := manifestSet.NewEditBatch()
+	if err := batch.Enforce(manifestSet, policy); err != nil {
+		return err
+	}
 	var errs []error
+	explicit := map[string]bool{}
 	for _, f := range values {
-		if err := batch.Set(f.Field, f.Value); err != nil {
+		n := canonicalName(manifestSet.Fields, f.Field)
+		if err := batch.Set(n, f.Value); err != nil {
 			errs = append(errs, err)
 		}
+		explicit[n] = true
 	}
 	if errs != nil {
 		return errors.Join(errs...)
 	}
+
+	var generated []string
+	if s.Generate {
+		if generated, err = manifestSet.generateValues(batch, explicit); err != nil {
+			return err
+		}
+	}
+
 	if err := batch.Commit(); err != nil {
 		return err
 	}
+	if err := manifestSet.markGenerated(generated); err != nil {
+		return err
+	}
 
 	if s.Freeze {
-		if err := freeze(manifestSet); err != nil {
+		if err := freeze(manifestSet, "", s.Baseline, policy); err != nil {
 			return err
 		}
 	}
 
-	return manifestSet.Manifests.Commit()
+	if s.Diff {
+		return manifestSet.Diff(os.Stdout)
+	}
+	return manifestSet.Commit()
+}
+
+// canonicalName returns the name of the field n refers to, warning if n is a deprecated name.
+func canonicalName(fields Fields, n string) string {
+	c, deprecated := fields.canonical(n)
+	if deprecated {
+		fmt.Fprintf(os.Stderr, "warning: field %q is deprecated, use %q instead\n", n, c)
+	}
+	return c
 }
 
 func settersFromFiles(paths []string) ([]Setter, error) {
@@ -169,6 +251,10 @@ func settersFromFiles(paths []string) ([]Setter, error) {
 		return nil, errors.Join(errs...)
 	}
 	for k, v := range all {
+		if v == redactedValue {
+			fmt.Fprintf(os.Stderr, "warning: skipping redacted value of field %q\n", k)
+			continue
+		}
 		res = append(res, Setter{k, v})
 	}
 	return res, nil
@@ -196,6 +282,7 @@ func parseSimplifiedValues(path string) (map[string]string, error) {
 
 type DiffCmd struct {
 	CommonFlags
+	SecretsFlags
 }
 
 func (s *DiffCmd) Run(ctx *Context) error {
@@ -207,14 +294,20 @@ func (s *DiffCmd) Run(ctx *Context) error {
 	if err != nil {
 		return err
 	}
+	for n, v := range d {
+		d[n] = manifestSet.Fields.redact(n, v, s.ShowSecrets)
+	}
 	return yaml.NewEncoder(os.Stdout).Encode(d)
 }
 
+// diff returns the values of the fields that differ from the original values,
+// as well as the values of the generated fields.
 func diff(manifestSet *ManifestSet) (map[string]string, error) {
 	o, err := findOriginal(manifestSet)
 	if err != nil {
 		return nil, err
 	}
+	gen := manifestSet.generated()
 
 	dirty := map[string]string{}
 	for n, k := range manifestSet.Fields {
@@ -222,58 +315,60 @@ func diff(manifestSet *ManifestSet) (map[string]string, error) {
 		if err != nil {
 			return nil, err
 		}
-		if v := values[0].value; o[n] != v {
+		if v := values[0].value; o[n] != v || gen[n] {
 			dirty[n] = v
 		}
 	}
 	return dirty, nil
 }
 
-func freeze(ms *ManifestSet) error {
-	for _, m := range ms.Manifests {
-		if _, ok := m.Metadata.Annotations[originalAnno]; ok {
-			if err := updateOriginalAnno(m.source, ms.Fields); err != nil {
-				return err
+// renderOriginalAnnoBody renders the values of the fields to be saved as the original values
+// (see Field.baselineValue). The values found in kept are saved as is.
+func renderOriginalAnnoBody(fields Fields, kept map[string]string) ([]byte, error) {
+	values := &yaml.Node{Kind: yaml.MappingNode}
+	for _, n := range fields.Names() {
+		v, ok := kept[n]
+		if !ok {
+			var err error
+			if v, err = fields[n].baselineValue(); err != nil {
+				return nil, err
 			}
 		}
+		values.Content = append(values.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: n},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v})
 	}
-	return nil
-}
-
-func updateOriginalAnno(src manifestSource, fields map[string]Field) error {
-	path := fmt.Sprintf("/metadata/annotations/%s", strings.ReplaceAll(originalAnno, "/", "~1"))
-	body, err := renderOriginalAnnoBody(fields)
-	if err != nil {
-		return err
-	}
-	edits := []lensed.Mapping{
-		{fmt.Sprintf("~(yamls)/%d%s", src.streamPos, path), string(body)},
-	}
-	f := src.file
-	b, err := lensed.Apply(f.buf, edits)
-	if err != nil {
-		return err
-	}
-	f.buf = b
-	return nil
+	return yaml.Marshal(values)
 }
 
-func renderOriginalAnnoBody(fields map[string]Field) ([]byte, error) {
-	values := map[string]string{}
-	for n, k := range fields {
+// renderValues renders the current values of all fields as a YAML map.
+// The values of sensitive fields are redacted unless showSecrets is true.
+// If annotate is true, the deprecated names of each field are listed in a comment.
+func renderValues(fields Fields, showSecrets, annotate bool) ([]byte, error) {
+	values := &yaml.Node{Kind: yaml.MappingNode}
+	for _, n := range fields.Names() {
+		k := fields[n]
 		kv, err := k.GetAll()
 		if err != nil {
 			return nil, err
 		}
-		values[n] = kv[0].value
+		v := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: fields.redact(n, kv[0].value, showSecrets)}
+		if annotate && len(k.Aliases) > 0 {
+			v.LineComment = fmt.Sprintf("deprecated names: %s", strings.Join(k.Aliases, ", "))
+		}
+		values.Content = append(values.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: n}, v)
 	}
-	return yaml.Marshal(&values)
+	return yaml.Marshal(values)
 }
 
 type PullCmd struct {
 	CommonFlags
 	CommonSchemaFlags
+	CommonPolicyFlags
+	SecretsFlags
+
 	Upstream string `arg:"" help:"Upstream file/URL." type:"file"`
+	Diff     bool   `name:"diff" help:"Show a unified diff of the changes instead of writing them."`
 }
 
 func (s *PullCmd) Run(ctx *Context) error {
@@ -308,23 +403,55 @@ func (s *PullCmd) Run(ctx *Context) error {
 	if err != nil {
 		return err
 	}
-	batch := manifestSetU.Fields.NewEditBatch()
+	policy, err := s.CommonPolicyFlags.load()
+	if err != nil {
+		return err
+	}
+	batch := manifestSetU.NewEditBatch()
+	if err := batch.Enforce(manifestSetU, policy); err != nil {
+		return err
+	}
+	var errs []error
 	for n, v := range d {
-		batch.Set(n, v)
+		if _, err := manifestSetU.Fields.lookup(n); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: skipping field %q, not found upstream\n", n)
+			continue
+		}
+		if err := batch.Set(n, v); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if errs != nil {
+		return errors.Join(errs...)
 	}
 	if err := batch.Commit(); err != nil {
 		return err
 	}
+	var generated []string
+	for n := range manifestSetC.generated() {
+		generated = append(generated, n)
+	}
+	if err := manifestSetU.markGenerated(generated); err != nil {
+		return err
+	}
+	if err := manifestSetU.finalize(); err != nil {
+		return err
+	}
 
 	msC, msU := manifestSetC.Manifests, manifestSetU.Manifests
 	msC[0].source.file.buf = msU[0].source.file.buf
 
+	if s.Diff {
+		manifestSetC.showSecrets = s.ShowSecrets
+		return manifestSetC.writeDiff(os.Stdout)
+	}
 	return manifestSetC.Manifests.Commit()
 }
 
 type ValuesCmd struct {
 	CommonFlags
 	CommonSchemaFlags
+	SecretsFlags
 
 	NamesOnly bool   `short:"k" help:"Print only field names and not their values."`
 	Field     string `arg:"" optional:"" help:"Print the value of one specific field"`
@@ -342,14 +469,15 @@ func (s *ValuesCmd) Run(ctx *Context) error {
 		}
 		return nil
 	} else if s.Field != "" {
-		v, err := manifestSet.Fields.GetValue(s.Field)
+		n := canonicalName(manifestSet.Fields, s.Field)
+		v, err := manifestSet.Fields.GetValue(n)
 		if err != nil {
 			return err
 		}
-		fmt.Println(v)
+		fmt.Println(manifestSet.Fields.redact(n, v, s.ShowSecrets))
 		return nil
 	} else {
-		b, err := renderOriginalAnnoBody(manifestSet.Fields)
+		b, err := renderValues(manifestSet.Fields, s.ShowSecrets, true)
 		if err != nil {
 			return err
 		}
@@ -358,24 +486,6 @@ func (s *ValuesCmd) Run(ctx *Context) error {
 	}
 }
 
-type LintCmd struct {
-	CommonFlags
-	CommonSchemaFlags
-}
-
-func (s *LintCmd) Run(ctx *Context) error {
-	manifestSet, err := openFields(s.Paths, s.Schema)
-	if err != nil {
-		return err
-	}
-
-	if err := checkFields(manifestSet.Fields); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 type errNotUniqueValue struct{ err error }
 
 func (e errNotUniqueValue) Error() string { return e.err.Error() }
@@ -386,7 +496,9 @@ func isNotUniqueValueError(err error) bool {
 	return errors.As(err, &u)
 }
 
-func checkFields(fields Fields) error {
+// checkFields checks that all the values pointed by each field are the same.
+// The values of sensitive fields are redacted from the errors unless showSecrets is true.
+func checkFields(fields Fields, showSecrets bool) error {
 	var errs []error
 	for _, n := range fields.Names() {
 		values, err := fields.GetAll(n)
@@ -395,7 +507,7 @@ func checkFields(fields Fields) error {
 		} else if !checkFieldValues(values) {
 			var vs []string
 			for _, v := range values {
-				vs = append(vs, v.value)
+				vs = append(vs, fields.redact(n, v.value, showSecrets))
 			}
 			errs = append(errs, fmt.Errorf("values pointed by field %q are not unique (%q)", n, vs))
 		}
@@ -409,9 +521,18 @@ func checkFields(fields Fields) error {
 type SchemaCmd struct {
 	CommonFlags
 	CommonSchemaFlags
+	SecretsFlags
+
+	Inline  bool `name:"inline" xor:"schema-edit" help:"Write the annotations of the schema file into the manifests."`
+	Extract bool `name:"extract" xor:"schema-edit" help:"Move the field annotations of the manifests to the schema file (Knot8file by default)."`
+	Diff    bool `name:"diff" help:"With --inline or --extract, show a unified diff of the changes instead of writing them."`
 }
 
 func (s *SchemaCmd) Run(ctx *Context) error {
+	if s.Inline || s.Extract {
+		return s.edit()
+	}
+
 	manifestSet, err := openFields(s.Paths, s.Schema)
 	if err != nil {
 		return err
@@ -420,6 +541,24 @@ func (s *SchemaCmd) Run(ctx *Context) error {
 	enc := yaml.NewEncoder(os.Stdout)
 	for _, m := range manifestSet.Manifests {
 		if len(m.Metadata.Annotations) > 0 {
+			// sidecar files are referenced by the annotation and don't need to be redacted.
+			if o, ok := m.Metadata.Annotations[originalAnno]; ok && !s.ShowSecrets && baselineForm(o) != baselineFile {
+				body, err := manifestSet.decodeOriginalAnno(m)
+				if err != nil {
+					return err
+				}
+				r, err := redactOriginalAnnoBody(body, manifestSet.Fields)
+				if err != nil {
+					return err
+				}
+				c := *m
+				c.Metadata.Annotations = map[string]string{}
+				for k, v := range m.Metadata.Annotations {
+					c.Metadata.Annotations[k] = v
+				}
+				c.Metadata.Annotations[originalAnno] = r
+				m = &c
+			}
 			enc.Encode(m)
 		}
 	}
@@ -427,6 +566,19 @@ func (s *SchemaCmd) Run(ctx *Context) error {
 	return nil
 }
 
+// redactOriginalAnnoBody redacts the values of the sensitive fields from the body of an original annotation.
+func redactOriginalAnnoBody(body string, fields Fields) (string, error) {
+	var values map[string]string
+	if err := yaml.Unmarshal([]byte(body), &values); err != nil {
+		return "", err
+	}
+	for n, v := range values {
+		values[n] = fields.redact(n, v, false)
+	}
+	b, err := yaml.Marshal(values)
+	return string(b), err
+}
+
 // openFields returns a map of fields defined in the set of files referenced by the path arguments (see openFiles).
 // It also returns a printStdin callback, meant to be called before exiting successfully in order
 // to print out the content of the (possibly modified) stream when using knot8 in "pipe" mode.
@@ -434,6 +586,7 @@ func openFields(paths []string, schema string) (*ManifestSet, error) {
 	var (
 		manifests Manifests
 		fields    Fields
+		schemaMs  Manifests
 	)
 	if len(paths) == 0 {
 		paths = []string{"-"}
@@ -454,7 +607,12 @@ func openFields(paths []string, schema string) (*ManifestSet, error) {
 		s, err := newShadowFile(f)
 		if err != nil {
 			errs = append(errs, err)
-		} else if ms, err := parseManifests(s); err != nil {
+			continue
+		}
+		// conditional resources disabled in-place are restored, so that their fields
+		// are available and they can be re-enabled.
+		s.buf = enableDocs(s.buf)
+		if ms, err := parseManifests(s); err != nil {
 			errs = append(errs, err)
 		} else {
 			manifests = append(manifests, ms...)
@@ -478,6 +636,7 @@ func openFields(paths []string, schema string) (*ManifestSet, error) {
 		if err != nil {
 			return nil, err
 		}
+		schemaMs = ms
 		ms = ms.Intersect(manifests)
 		manifests.MergeAnnotations(ms)
 		ext, err := parseFields(ms)
@@ -490,10 +649,14 @@ func openFields(paths []string, schema string) (*ManifestSet, error) {
 		fields.MergeSchema(ext)
 	}
 
-	err = checkFields(fields)
+	if err := fields.checkDefined(); err != nil {
+		return nil, err
+	}
+
+	err = checkFields(fields, false)
 	// let the caller decide whether the validation error is fatal
 
-	return &ManifestSet{Fields: fields, Manifests: manifests}, err
+	return &ManifestSet{Fields: fields, Manifests: manifests, schema: schemaMs}, err
 }
 
 func main() {
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"path"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -52,6 +53,14 @@ func (f FQN) String() string {
 	return string(b)
 }
 
+// Short returns a short human readable name, in the form Kind/name or Kind/namespace/name.
+func (f FQN) Short() string {
+	if f.Namespace != "" {
+		return fmt.Sprintf("%s/%s/%s", f.Kind, f.Namespace, f.Name)
+	}
+	return fmt.Sprintf("%s/%s", f.Kind, f.Name)
+}
+
 type manifestSource struct {
 	file      *shadowFile
 	streamPos int // position in yaml stream
@@ -117,23 +126,101 @@ func (ms Manifests) Commit() error {
 	return nil
 }
 
-// Intersect return the set of manifests in the receiver that
-// also exist in src. Equality is matched used the FQN method.
+// Intersect returns the set of manifests in the receiver that match a manifest in src (see matches),
+// rewritten to describe the matched manifest: manifests matched by several manifests of the receiver
+// carry the union of their annotations, with exact matches taking precedence over patterns and later
+// patterns over earlier ones.
 func (ms Manifests) Intersect(src Manifests) Manifests {
-	exists := map[FQN]bool{}
-	for _, s := range src {
-		exists[s.FQN()] = true
-	}
+	var (
+		res  Manifests
+		seen = map[FQN]bool{}
+	)
+	for _, d := range src {
+		if seen[d.FQN()] {
+			continue
+		}
+		seen[d.FQN()] = true
 
-	var res Manifests
-	for _, d := range ms {
-		if exists[d.FQN()] {
-			res = append(res, d)
+		var patterns, exact Manifests
+		for _, s := range ms {
+			switch {
+			case !s.matches(d):
+			case s.isPattern():
+				patterns = append(patterns, s)
+			default:
+				exact = append(exact, s)
+			}
+		}
+		matched := append(patterns, exact...)
+		switch {
+		case len(matched) == 0:
+			continue
+		case len(patterns) == 0 && len(exact) == 1:
+			res = append(res, exact[0])
+			continue
+		}
+
+		c := *matched[len(matched)-1]
+		c.VersionKind = d.VersionKind
+		c.Metadata.NamespacedName = d.Metadata.NamespacedName
+		c.Metadata.Annotations = map[string]string{}
+		for _, s := range matched {
+			for k, v := range s.Metadata.Annotations {
+				c.Metadata.Annotations[k] = v
+			}
 		}
+		res = append(res, &c)
 	}
 	return res
 }
 
+// isPattern returns true if the (schema) manifest describes a set of resources rather than a single one,
+// i.e. if its name is omitted or contains glob metacharacters (see path.Match), or if it has labels.
+func (m *Manifest) isPattern() bool {
+	return m.Metadata.Name == "" || strings.ContainsAny(m.Metadata.Name, "*?[") || len(m.labels()) > 0
+}
+
+// matches returns true if the (schema) manifest m describes the manifest o.
+// Exact manifests match by FQN. Patterns (see isPattern) match the manifests of the same kind
+// whose name and namespace match theirs as glob patterns and that carry all of their labels.
+// An omitted apiVersion, name or namespace matches any.
+func (m *Manifest) matches(o *Manifest) bool {
+	if !m.isPattern() {
+		return m.FQN() == o.FQN()
+	}
+	if m.Kind == "" || m.Kind != o.Kind || (m.APIVersion != "" && m.APIVersion != o.APIVersion) {
+		return false
+	}
+	for _, p := range [][2]string{{m.Metadata.Name, o.Metadata.Name}, {m.Metadata.Namespace, o.Metadata.Namespace}} {
+		if p[0] == "" {
+			continue
+		}
+		if ok, _ := path.Match(p[0], p[1]); !ok {
+			return false
+		}
+	}
+	labels := o.labels()
+	for k, v := range m.labels() {
+		if l, ok := labels[k]; !ok || l != v {
+			return false
+		}
+	}
+	return true
+}
+
+// labels returns the labels of the manifest.
+func (m *Manifest) labels() map[string]string {
+	var r struct {
+		Metadata struct {
+			Labels map[string]string
+		}
+	}
+	if err := m.raw.Decode(&r); err != nil {
+		return nil
+	}
+	return r.Metadata.Labels
+}
+
 // MergeAnnotations copies annotations from the src into ms if they exist
 func (ms Manifests) MergeAnnotations(src Manifests) {
 	anns := map[FQN]map[string]string{}
@@ -153,6 +240,38 @@ func (ms Manifests) MergeAnnotations(src Manifests) {
 	}
 }
 
+// root returns the root node of the manifest's document.
+func (m *Manifest) root() *yaml.Node {
+	if m.raw.Kind == yaml.DocumentNode && len(m.raw.Content) > 0 {
+		return m.raw.Content[0]
+	}
+	return &m.raw
+}
+
+// annotationComments returns the comments attached to each annotation in the source of the manifest.
+func (m *Manifest) annotationComments() map[string]string {
+	res := map[string]string{}
+	n, ok := (Pointer{Expr: "/metadata/annotations", Manifest: m}).resolveNode()
+	if !ok || n.Kind != yaml.MappingNode {
+		return res
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		var lines []string
+		for _, c := range []string{k.HeadComment, k.LineComment, v.LineComment} {
+			for _, l := range strings.Split(c, "\n") {
+				if l = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(l), "#")); l != "" {
+					lines = append(lines, l)
+				}
+			}
+		}
+		if lines != nil {
+			res[k.Value] = strings.Join(lines, " ")
+		}
+	}
+	return res
+}
+
 func isOurAnnotation(a string) bool {
 	c := strings.SplitN(a, "/", 2)
 	return strings.HasSuffix(c[0], annoDomain)
@@ -0,0 +1,95 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestIntersectPatterns(t *testing.T) {
+	manifests := parseTestManifestSet(t, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    tier: front
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+  namespace: jobs
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cfg-a
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other
+`).Manifests
+
+	schema, err := parseManifests(&shadowFile{name: "Knot8file", buf: []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  annotations:
+    field.knot8.io/image: /a
+    field.knot8.io/name: /kind
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  labels:
+    tier: front
+  annotations:
+    field.knot8.io/front: /b
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+  namespace: jobs
+  annotations:
+    field.knot8.io/name: /metadata/name
+---
+kind: ConfigMap
+metadata:
+  name: cfg-*
+  annotations:
+    field.knot8.io/cfg: /c
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  namespace: kube-*
+  annotations:
+    field.knot8.io/system: /d
+`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, m := range schema.Intersect(manifests) {
+		var annos []string
+		for k, v := range m.Metadata.Annotations {
+			annos = append(annos, fmt.Sprintf("%s=%s", k, v))
+		}
+		sort.Strings(annos)
+		got = append(got, fmt.Sprintf("%s %v", m.FQN().Short(), annos))
+	}
+	want := []string{
+		"Deployment/web [field.knot8.io/front=/b field.knot8.io/image=/a field.knot8.io/name=/kind]",
+		"Deployment/jobs/worker [field.knot8.io/image=/a field.knot8.io/name=/metadata/name]",
+		"ConfigMap/cfg-a [field.knot8.io/cfg=/c]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
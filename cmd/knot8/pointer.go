@@ -0,0 +1,198 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type PointerCmd struct {
+	Position string `arg:"" help:"Position in the form file:line[:column]."`
+	Relative bool   `name:"relative" help:"Omit the ~(yamls)/N prefix of multi-document files, yielding a pointer relative to the resource."`
+	Lens     bool   `name:"lens" help:"Descend into YAML (or JSON) documents embedded in block scalars, using the yaml lens."`
+}
+
+func (s *PointerCmd) Run(ctx *Context) error {
+	file, line, col, err := parsePosition(s.Position)
+	if err != nil {
+		return err
+	}
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	doc, ptr, err := pointerAt(buf, line, col, s.Lens)
+	if err != nil {
+		return err
+	}
+	if !s.Relative {
+		if docs, err := parseYAMLDocs(buf); err == nil && len(docs) > 1 {
+			ptr = fmt.Sprintf("~(yamls)/%d%s", doc, ptr)
+		}
+	}
+	fmt.Println(ptr)
+	return nil
+}
+
+// parsePosition parses a position in the form file:line[:column]. The column defaults to 0.
+func parsePosition(s string) (file string, line, col int, err error) {
+	c := strings.Split(s, ":")
+	nums := []int{}
+	for len(c) > 1 && len(nums) < 2 {
+		n, err := strconv.Atoi(c[len(c)-1])
+		if err != nil {
+			break
+		}
+		nums = append([]int{n}, nums...)
+		c = c[:len(c)-1]
+	}
+	if len(nums) == 0 {
+		return "", 0, 0, fmt.Errorf("bad position %q, expecting file:line[:column]", s)
+	}
+	file, line = strings.Join(c, ":"), nums[0]
+	if len(nums) > 1 {
+		col = nums[1]
+	}
+	return file, line, col, nil
+}
+
+// pointerAt returns the index of the YAML document containing the given (1-based) line and column
+// along with a pointer to the node at that position, relative to the document.
+// A column of 0 selects the first non blank character of the line.
+// Positions inside a mapping key select the value of that key.
+// Array elements that are objects with a unique name are addressed with a ~{"name":...} matcher.
+// If lens is true, the pointer descends into YAML documents embedded in literal block scalars.
+func pointerAt(buf []byte, line, col int, lens bool) (int, string, error) {
+	lines := strings.SplitAfter(string(buf), "\n")
+	if line < 1 || line > len(lines) {
+		return 0, "", fmt.Errorf("line %d out of range", line)
+	}
+	if col == 0 {
+		col = len([]rune(lines[line-1])) - len([]rune(strings.TrimLeft(lines[line-1], " \t"))) + 1
+	}
+	off := col - 1
+	for _, l := range lines[:line-1] {
+		off += len([]rune(l))
+	}
+
+	docs, err := parseYAMLDocs(buf)
+	if err != nil {
+		return 0, "", err
+	}
+	doc := -1
+	for i, d := range docs {
+		if len(d.Content) > 0 && d.Content[0].Index <= off {
+			doc = i
+		}
+	}
+	if doc < 0 {
+		return 0, "", fmt.Errorf("no YAML node at %d:%d", line, col)
+	}
+
+	ptr, n := nodePointer(docs[doc].Content[0], off)
+	if lens && n.Kind == yaml.ScalarNode && n.Style&yaml.LiteralStyle != 0 && line > n.Line {
+		if inner, ok := embeddedPointer(n, lines, line, col); ok {
+			ptr += inner
+		}
+	}
+	return doc, ptr, nil
+}
+
+// nodePointer returns the pointer to the deepest node under n containing the rune offset off, and the node itself.
+func nodePointer(n *yaml.Node, off int) (string, *yaml.Node) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		i := -1
+		for j := 0; j+1 < len(n.Content); j += 2 {
+			if n.Content[j].Index <= off {
+				i = j
+			}
+		}
+		if i < 0 {
+			return "", n
+		}
+		k, v := n.Content[i], n.Content[i+1]
+		tok := "/" + escapePointerToken(k.Value)
+		if off < v.Index {
+			// on the key (or before the value)
+			return tok, v
+		}
+		p, c := nodePointer(v, off)
+		return tok + p, c
+	case yaml.SequenceNode:
+		i := -1
+		for j, e := range n.Content {
+			if e.Index <= off {
+				i = j
+			}
+		}
+		if i < 0 {
+			return "", n
+		}
+		p, c := nodePointer(n.Content[i], off)
+		return "/" + elementToken(n, i) + p, c
+	default:
+		return "", n
+	}
+}
+
+// elementToken returns a token addressing the i-th element of the sequence n, preferring a
+// ~{"name":...} matcher if the element is an object with a name that is unique in the sequence.
+func elementToken(n *yaml.Node, i int) string {
+	name := func(e *yaml.Node) (string, bool) {
+		if e.Kind != yaml.MappingNode {
+			return "", false
+		}
+		for j := 0; j+1 < len(e.Content); j += 2 {
+			if k, v := e.Content[j], e.Content[j+1]; k.Value == "name" && v.Kind == yaml.ScalarNode {
+				return v.Value, true
+			}
+		}
+		return "", false
+	}
+
+	v, ok := name(n.Content[i])
+	if !ok {
+		return strconv.Itoa(i)
+	}
+	for j, e := range n.Content {
+		if o, ok := name(e); ok && j != i && o == v {
+			return strconv.Itoa(i)
+		}
+	}
+	b, _ := json.Marshal(map[string]string{"name": v})
+	return "~" + string(b)
+}
+
+// embeddedPointer returns the pointer, prefixed by the yaml lens, to the node at the given position
+// in the YAML document embedded in the literal block scalar n.
+func embeddedPointer(n *yaml.Node, lines []string, line, col int) (string, bool) {
+	// the indentation of the block is given by its first non empty line.
+	indent := -1
+	for _, l := range lines[n.Line:] {
+		if t := strings.TrimLeft(l, " "); strings.TrimSpace(t) != "" {
+			indent = len(l) - len(t)
+			break
+		}
+	}
+	if indent < 0 || col <= indent {
+		return "", false
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(n.Value), &root); err != nil || len(root.Content) == 0 || root.Content[0].Kind == yaml.ScalarNode {
+		return "", false
+	}
+	_, p, err := pointerAt([]byte(n.Value), line-n.Line, col-indent, true)
+	if err != nil {
+		return "", false
+	}
+	return "/~(yaml)" + p, true
+}
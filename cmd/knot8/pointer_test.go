@@ -0,0 +1,93 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPointerAt(t *testing.T) {
+	src := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+data:
+  cfg: |
+    foo:
+      bar: 1
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: demo
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: nginx
+        args:
+        - a
+        - b
+      - name: app
+        image: busybox
+      - name: side
+        image: busybox
+`
+	testCases := []struct {
+		line, col int
+		lens      bool
+		doc       int
+		ptr       string
+	}{
+		{4, 9, false, 0, "/metadata/name"},
+		{4, 3, false, 0, "/metadata/name"},
+		{4, 0, false, 0, "/metadata/name"},
+		{8, 12, false, 0, "/data/cfg"},
+		{8, 12, true, 0, "/data/cfg/~(yaml)/foo/bar"},
+		{6, 3, true, 0, "/data/cfg"},
+		{19, 16, false, 1, "/spec/template/spec/containers/0/image"},
+		{22, 11, false, 1, "/spec/template/spec/containers/0/args/1"},
+		{26, 0, false, 1, `/spec/template/spec/containers/~{"name":"side"}/image`},
+		{25, 9, false, 1, `/spec/template/spec/containers/~{"name":"side"}/name`},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			doc, ptr, err := pointerAt([]byte(src), tc.line, tc.col, tc.lens)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := fmt.Sprintf("%d:%s", doc, ptr), fmt.Sprintf("%d:%s", tc.doc, tc.ptr); got != want {
+				t.Errorf("got: %q, want: %q", got, want)
+			}
+		})
+	}
+}
+
+func TestParsePosition(t *testing.T) {
+	testCases := []struct {
+		src  string
+		want string
+	}{
+		{"a.yaml:3:4", "a.yaml 3 4"},
+		{"a.yaml:3", "a.yaml 3 0"},
+		{"c:a.yaml:3:4", "c:a.yaml 3 4"},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			file, line, col, err := parsePosition(tc.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(file, " ", line, " ", col); got != tc.want {
+				t.Errorf("got: %q, want: %q", got, tc.want)
+			}
+		})
+	}
+
+	if _, _, _, err := parsePosition("a.yaml"); err == nil {
+		t.Errorf("expecting error")
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	Knot8policy = "Knot8policy"
+
+	immutablePrefix = "immutable.knot8.io/"
+)
+
+// A Policy restricts which fields can be changed.
+// Each entry is a field name pattern (see path.Match).
+type Policy struct {
+	// Allow lists the only fields that can be changed. If empty, all fields can be changed.
+	Allow []string `yaml:"allow"`
+	// Deny lists fields that can never be changed.
+	Deny []string `yaml:"deny"`
+	// Immutable lists fields that cannot be changed anymore once they diverged from their original value,
+	// like fields marked by the immutable.knot8.io annotation.
+	Immutable []string `yaml:"immutable"`
+
+	name string
+}
+
+func loadPolicy(filename string) (*Policy, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	if err := yaml.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("parsing policy %q: %w", filename, err)
+	}
+	for _, l := range [][]string{p.Allow, p.Deny, p.Immutable} {
+		for _, pat := range l {
+			if _, err := path.Match(pat, ""); err != nil {
+				return nil, fmt.Errorf("policy %q: bad pattern %q: %w", filename, pat, err)
+			}
+		}
+	}
+	p.name = filename
+	return &p, nil
+}
+
+func matchAny(patterns []string, n string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, n); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// canChange returns an error if the policy forbids changing the field n.
+func (p *Policy) canChange(n string) error {
+	if p == nil {
+		return nil
+	}
+	if matchAny(p.Deny, n) || (len(p.Allow) > 0 && !matchAny(p.Allow, n)) {
+		return fmt.Errorf("policy %q forbids changing field %q", p.name, n)
+	}
+	return nil
+}
+
+func (p *Policy) isImmutable(k Field) bool {
+	return k.Immutable || (p != nil && matchAny(p.Immutable, k.Name))
+}
+
+// An editPolicy checks the edits performed by an EditBatch.
+type editPolicy struct {
+	policy   *Policy
+	original map[string]string
+}
+
+// check returns an error if the field k cannot be set to v.
+// Setting a field to its current value is always allowed, as is setting an immutable
+// field whose original value is not recorded yet, e.g. at first install.
+func (e *editPolicy) check(ks Fields, k Field, v string) error {
+	cur, err := ks.GetValue(k.Name)
+	if err != nil {
+		return err
+	}
+	return e.checkChange(k, cur, v)
+}
+
+// checkChange returns an error if the field k cannot be changed from cur to v (see check).
+func (e *editPolicy) checkChange(k Field, cur, v string) error {
+	if cur == v {
+		return nil
+	}
+	if err := e.policy.canChange(k.Name); err != nil {
+		return err
+	}
+	if e.policy.isImmutable(k) {
+		if o, ok := e.original[k.Name]; ok && o != cur {
+			return fmt.Errorf("field %q is immutable and has already been changed from its original value", k.Name)
+		}
+	}
+	return nil
+}
+
+// Enforce makes the batch reject the edits forbidden by the policy and by the immutable fields.
+func (b *EditBatch) Enforce(ms *ManifestSet, p *Policy) error {
+	o, err := findOriginal(ms)
+	if err != nil {
+		return err
+	}
+	b.policy = &editPolicy{policy: p, original: o}
+	return nil
+}
+
+// policyViolations returns the names of the fields that the policy forbids changing
+// but no longer hold their original values, among the fields whose original value is known.
+func policyViolations(ms *ManifestSet, p *Policy) ([]string, error) {
+	if p == nil {
+		return nil, nil
+	}
+	o, err := findOriginal(ms)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, n := range ms.Fields.Names() {
+		if p.canChange(n) == nil {
+			continue
+		}
+		orig, ok := o[n]
+		if !ok {
+			continue
+		}
+		// fields pointing to divergent values are reported by the non-unique-value lint rule.
+		if v, err := ms.Fields.GetValue(n); err == nil && orig != v {
+			res = append(res, n)
+		}
+	}
+	return res, nil
+}
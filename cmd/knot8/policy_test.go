@@ -0,0 +1,192 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTestPolicy(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), Knot8policy)
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPolicy(t *testing.T) {
+	p, err := loadPolicy(writeTestPolicy(t, "allow:\n- a*\ndeny:\n- ab\nimmutable:\n- c\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := [][]string{p.Allow, p.Deny, p.Immutable}, [][]string{{"a*"}, {"ab"}, {"c"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	testCases := []struct {
+		field string
+		ok    bool
+	}{
+		{"a", true},
+		{"aa", true},
+		{"ab", false},
+		{"c", false},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			if got, want := p.canChange(tc.field) == nil, tc.ok; got != want {
+				t.Errorf("got: %v, want: %v", got, want)
+			}
+		})
+	}
+
+	for _, src := range []string{"allow:\n- '['\n", "deny: 1\n"} {
+		if _, err := loadPolicy(writeTestPolicy(t, src)); err == nil {
+			t.Errorf("expecting error for %q", src)
+		}
+	}
+}
+
+const policyTestManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/a: /data/a
+    field.knot8.io/b: /data/b
+    field.knot8.io/c: /data/c
+    field.knot8.io/d: /data/d
+    field.knot8.io/e: /data/e
+    immutable.knot8.io/a: "true"
+    immutable.knot8.io/b: "true"
+    immutable.knot8.io/c: "true"
+    knot8.io/original: |
+      a: x
+      b: x
+      d: x
+      e: x
+data:
+  a: x
+  b: y
+  c: x
+  d: y
+  e: x
+`
+
+func TestEnforce(t *testing.T) {
+	p, err := loadPolicy(writeTestPolicy(t, "deny:\n- d\nimmutable:\n- e\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		field, value string
+		ok           bool
+	}{
+		{"a", "z", true},  // immutable, still holding its original value
+		{"b", "z", false}, // immutable, already changed
+		{"b", "y", true},  // setting the current value is always allowed
+		{"c", "z", true},  // immutable, without original value
+		{"d", "z", false}, // denied
+		{"e", "z", true},  // immutable by the policy, still holding its original value
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			ms := parseTestManifestSet(t, policyTestManifest)
+			b := ms.NewEditBatch()
+			if err := b.Enforce(ms, p); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := b.Set(tc.field, tc.value) == nil, tc.ok; got != want {
+				t.Errorf("got: %v, want: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPolicyViolations(t *testing.T) {
+	p, err := loadPolicy(writeTestPolicy(t, "deny:\n- b\n- d\n- e\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := parseTestManifestSet(t, policyTestManifest)
+	got, err := policyViolations(ms, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestPullPolicy(t *testing.T) {
+	dir := t.TempDir()
+	cur, up := filepath.Join(dir, "current.yaml"), filepath.Join(dir, "upstream.yaml")
+	if err := os.WriteFile(cur, []byte(policyTestManifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the current manifest changed d from the upstream default.
+	if err := os.WriteFile(up, []byte(strings.Replace(policyTestManifest, "\n  d: y\n", "\n  d: x\n", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		policy string
+		ok     bool
+	}{
+		{"deny:\n- c\n", true},
+		{"deny:\n- d\n", false},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			s := PullCmd{
+				CommonFlags:       CommonFlags{Paths: []string{cur}},
+				CommonPolicyFlags: CommonPolicyFlags{Policy: writeTestPolicy(t, tc.policy)},
+				Upstream:          up,
+			}
+			if got, want := s.Run(&Context{}) == nil, tc.ok; got != want {
+				t.Errorf("got: %v, want: %v", got, want)
+			}
+		})
+	}
+}
+
+// TestPullDroppedField checks that the fields dropped upstream are skipped.
+func TestPullDroppedField(t *testing.T) {
+	dir := t.TempDir()
+	cur, up := filepath.Join(dir, "current.yaml"), filepath.Join(dir, "upstream.yaml")
+	if err := os.WriteFile(cur, []byte(policyTestManifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the current manifest changed d from the upstream default, but upstream no longer defines d.
+	src := strings.Replace(policyTestManifest, "    field.knot8.io/d: /data/d\n", "", 1)
+	if err := os.WriteFile(up, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := PullCmd{CommonFlags: CommonFlags{Paths: []string{cur}}, Upstream: up}
+	if err := s.Run(&Context{}); err != nil {
+		t.Fatal(err)
+	}
+	ms, err := openFields([]string{cur}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ms.Fields["d"]; ok {
+		t.Errorf("field %q should have been dropped", "d")
+	}
+	values, err := ms.Fields.GetAll("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := values[0].value, "y"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
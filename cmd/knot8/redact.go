@@ -0,0 +1,206 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"io"
+	"strings"
+
+	yptr "github.com/vmware-labs/yaml-jsonpointer"
+	"gopkg.in/yaml.v3"
+)
+
+// redactedLines maps the index of a line to redact to the column (1-based) where the redacted value starts.
+// A zero column redacts the whole line content after the indentation.
+type redactedLines map[int]int
+
+// markValue marks the lines holding the value of the node n, whose first line has index line.
+func (r redactedLines) markValue(n *yaml.Node, line, col int) {
+	r[line] = col
+	if n.Kind != yaml.ScalarNode || n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+		return
+	}
+	for i := 1; i <= strings.Count(strings.TrimRight(n.Value, "\n"), "\n")+1; i++ {
+		r[line+i] = 0
+	}
+}
+
+// writeDiff writes the unified diff of the changes made to the sidecar files and to the manifests.
+// The values of the sensitive fields are redacted, unless showSecrets is set.
+func (ms *ManifestSet) writeDiff(w io.Writer) error {
+	diff := func(f *shadowFile, lines func([]byte) (redactedLines, error)) error {
+		d := f.Diff()
+		if d != "" && !ms.showSecrets {
+			ra, err := lines(f.orig)
+			if err != nil {
+				return err
+			}
+			rb, err := lines(f.buf)
+			if err != nil {
+				return err
+			}
+			d = redactedDiff(f.name, f.name, f.orig, f.buf, ra, rb)
+		}
+		_, err := io.WriteString(w, d)
+		return err
+	}
+
+	for _, s := range ms.sidecars {
+		if err := diff(s, ms.sensitiveValueLines); err != nil {
+			return err
+		}
+	}
+	uniq := map[*shadowFile]bool{}
+	for _, m := range ms.Manifests {
+		if f := m.source.file; !uniq[f] {
+			uniq[f] = true
+			if err := diff(f, ms.sensitiveLines); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sensitiveLines returns the lines of the YAML stream buf holding the values of the sensitive fields
+// and the sensitive entries of the original values, as well as the values of the Secrets.
+// Disabled resources (see disableDocs) are taken into account.
+func (ms *ManifestSet) sensitiveLines(buf []byte) (redactedLines, error) {
+	res := redactedLines{}
+	manifests, err := parseManifests(&shadowFile{buf: enableDocs(buf)})
+	if err != nil {
+		return nil, err
+	}
+	byFQN := map[FQN]*Manifest{}
+	for _, m := range manifests {
+		byFQN[m.FQN()] = m
+	}
+
+	for _, k := range ms.Fields {
+		if !k.IsSensitive() {
+			continue
+		}
+		for _, p := range k.Pointers {
+			m, ok := byFQN[p.Manifest.FQN()]
+			if !ok {
+				// the resource may have been renamed.
+				if pos := p.Manifest.source.streamPos; pos < len(manifests) {
+					m = manifests[pos]
+				} else {
+					continue
+				}
+			}
+			expr := p.Expr
+			if i := strings.Index(expr, "/~("); i >= 0 {
+				expr = expr[:i]
+			}
+			if n, err := yptr.Find(&m.raw, expr); err == nil {
+				res.markValue(n, n.Line-1, n.Column)
+			}
+		}
+	}
+
+	lines := splitLines(string(buf))
+	for _, m := range manifests {
+		if m.Kind == "Secret" {
+			for _, path := range []string{"/data", "/stringData"} {
+				if n, err := yptr.Find(&m.raw, path); err == nil && n.Kind == yaml.MappingNode {
+					for i := 1; i < len(n.Content); i += 2 {
+						v := n.Content[i]
+						res.markValue(v, v.Line-1, v.Column)
+					}
+				}
+			}
+		}
+
+		n, err := yptr.Find(&m.raw, "/metadata/annotations/"+escapePointerToken(originalAnno))
+		if err != nil || baselineForm(n.Value) != baselineInline {
+			continue
+		}
+		if n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			if ms.hasSensitiveValues(n.Value) {
+				res[n.Line-1] = n.Column
+			}
+			continue
+		}
+		// the body of a block scalar starts on the line following the indicator.
+		body, err := ms.sensitiveValueLines([]byte(n.Value))
+		if err != nil {
+			continue
+		}
+		for i, col := range body {
+			l := n.Line + i
+			if l >= len(lines) {
+				continue
+			}
+			if col > 0 {
+				col += indentation(strings.TrimPrefix(lines[l], disabledPrefix))
+			}
+			res[l] = col
+		}
+	}
+	return res, nil
+}
+
+// sensitiveValueLines returns the lines of the YAML stream buf holding the values of the sensitive fields,
+// for the documents that map field names to values, like the original values and the values files.
+func (ms *ManifestSet) sensitiveValueLines(buf []byte) (redactedLines, error) {
+	docs, err := parseYAMLDocs(buf)
+	if err != nil {
+		return nil, err
+	}
+	res := redactedLines{}
+	for _, d := range docs {
+		if len(d.Content) == 0 || d.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		n := d.Content[0]
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			c, _ := ms.Fields.canonical(n.Content[i].Value)
+			if k, ok := ms.Fields[c]; ok && k.IsSensitive() {
+				v := n.Content[i+1]
+				res.markValue(v, v.Line-1, v.Column)
+			}
+		}
+	}
+	return res, nil
+}
+
+// hasSensitiveValues returns true if the YAML map body holds the value of a sensitive field.
+func (ms *ManifestSet) hasSensitiveValues(body string) bool {
+	var values map[string]string
+	if err := yaml.Unmarshal([]byte(body), &values); err != nil {
+		return true
+	}
+	for n := range values {
+		c, _ := ms.Fields.canonical(n)
+		if k, ok := ms.Fields[c]; ok && k.IsSensitive() {
+			return true
+		}
+	}
+	return false
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// redactLine replaces the content of the line from the column col (see redactedLines) with the
+// redaction placeholder. The prefix of disabled resources is retained.
+func redactLine(line string, col int) string {
+	prefix := ""
+	if strings.HasPrefix(line, disabledPrefix) {
+		prefix, line = disabledPrefix, strings.TrimPrefix(line, disabledPrefix)
+	}
+	eol := ""
+	if strings.HasSuffix(line, "\n") {
+		eol, line = "\n", strings.TrimSuffix(line, "\n")
+	}
+	i := col - 1
+	if col == 0 {
+		i = indentation(line)
+	}
+	i = min(max(i, 0), len(line))
+	return prefix + line[:i] + redactedValue + eol
+}
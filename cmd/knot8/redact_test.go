@@ -0,0 +1,103 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRedactLine(t *testing.T) {
+	testCases := []struct {
+		line string
+		col  int
+		want string
+	}{
+		{"  password: s3cr3t\n", 13, "  password: <redacted>\n"},
+		{"  password: s3cr3t", 13, "  password: <redacted>"},
+		{"    s3cr3t\n", 0, "    <redacted>\n"},
+		{disabledPrefix + "  password: s3cr3t\n", 13, disabledPrefix + "  password: <redacted>\n"},
+		{"a: b\n", 99, "a: b<redacted>\n"},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			if got := redactLine(tc.line, tc.col); got != tc.want {
+				t.Errorf("got: %q, want: %q", got, tc.want)
+			}
+		})
+	}
+}
+
+const redactTestManifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/user: /data/user
+    field.knot8.io/token: /data/token
+    sensitive.knot8.io/token: "true"
+    knot8.io/original: |
+      token: old-token
+      user: admin
+data:
+  user: admin
+  token: old-token
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/password: /stringData/password
+stringData:
+  password: old-password
+  other: other-password
+`
+
+func TestDiffRedacted(t *testing.T) {
+	for _, showSecrets := range []bool{false, true} {
+		t.Run(fmt.Sprint(showSecrets), func(t *testing.T) {
+			ms := parseTestManifestSet(t, redactTestManifest)
+			ms.Manifests[0].source.file.orig = []byte(redactTestManifest)
+			ms.showSecrets = showSecrets
+			b := ms.NewEditBatch()
+			for n, v := range map[string]string{"user": "root", "token": "new-token", "password": "new-password"} {
+				if err := b.Set(n, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := b.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if err := freeze(ms, "", "", nil); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := ms.Diff(&buf); err != nil {
+				t.Fatal(err)
+			}
+			out := buf.String()
+			for _, s := range []string{"-  user: admin\n", "+  user: root\n", "+      user: root\n"} {
+				if !strings.Contains(out, s) {
+					t.Errorf("missing %q in:\n%s", s, out)
+				}
+			}
+			for _, s := range []string{"old-token", "new-token", "old-password", "new-password", "other-password"} {
+				if got, want := strings.Contains(out, s), showSecrets; got != want {
+					t.Errorf("%q shown: %v, want: %v, in:\n%s", s, got, want, out)
+				}
+			}
+			if !showSecrets {
+				for _, s := range []string{"-  token: <redacted>\n", "+  token: <redacted>\n", "+      token: <redacted>\n", "+  password: <redacted>\n"} {
+					if !strings.Contains(out, s) {
+						t.Errorf("missing %q in:\n%s", s, out)
+					}
+				}
+			}
+		})
+	}
+}
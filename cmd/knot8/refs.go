@@ -0,0 +1,275 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	yptr "github.com/vmware-labs/yaml-jsonpointer"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// resourceNamePrefix marks a field pointing to the name of a resource, causing the references
+	// to that resource to be updated along with the field.
+	resourceNamePrefix = "resource-name.knot8.io/"
+	// podLabelPrefix marks a field pointing to a pod template label, causing the label selectors
+	// matching that label to be updated along with the field.
+	podLabelPrefix = "pod-label.knot8.io/"
+
+	namePointer = "/metadata/name"
+)
+
+// A refPattern describes a location inside a resource that references
+// another resource of a given kind by name.
+// The path is a slash separated sequence of keys, where "*" matches any array element.
+type refPattern struct {
+	kind string
+	path string
+}
+
+// podSpecPaths maps the kinds of workload resources to the path of their pod spec.
+var podSpecPaths = map[string]string{
+	"Pod":         "spec",
+	"Deployment":  "spec/template/spec",
+	"StatefulSet": "spec/template/spec",
+	"DaemonSet":   "spec/template/spec",
+	"ReplicaSet":  "spec/template/spec",
+	"Job":         "spec/template/spec",
+	"CronJob":     "spec/jobTemplate/spec/template/spec",
+}
+
+// podTemplateMetadataPaths maps the kinds of workload resources to the path of the metadata of their pods.
+var podTemplateMetadataPaths = map[string]string{
+	"Pod":         "metadata",
+	"Deployment":  "spec/template/metadata",
+	"StatefulSet": "spec/template/metadata",
+	"DaemonSet":   "spec/template/metadata",
+	"ReplicaSet":  "spec/template/metadata",
+	"Job":         "spec/template/metadata",
+	"CronJob":     "spec/jobTemplate/spec/template/metadata",
+}
+
+// selectorPaths maps the kinds of resources selecting pods to the path of their label selectors.
+var selectorPaths = map[string]string{
+	"Deployment":          "spec/selector/matchLabels",
+	"StatefulSet":         "spec/selector/matchLabels",
+	"DaemonSet":           "spec/selector/matchLabels",
+	"ReplicaSet":          "spec/selector/matchLabels",
+	"PodDisruptionBudget": "spec/selector/matchLabels",
+	"Service":             "spec/selector",
+}
+
+// refPatterns returns the locations where resources of a given kind can reference other resources by name.
+func refPatterns(kind string) []refPattern {
+	var res []refPattern
+	if prefix, ok := podSpecPaths[kind]; ok {
+		for _, r := range podSpecRefs {
+			res = append(res, refPattern{r.kind, prefix + "/" + r.path})
+		}
+	}
+	return append(res, otherRefs[kind]...)
+}
+
+var podSpecRefs = func() []refPattern {
+	res := []refPattern{
+		{"ConfigMap", "volumes/*/configMap/name"},
+		{"ConfigMap", "volumes/*/projected/sources/*/configMap/name"},
+		{"Secret", "volumes/*/secret/secretName"},
+		{"Secret", "volumes/*/projected/sources/*/secret/name"},
+		{"PersistentVolumeClaim", "volumes/*/persistentVolumeClaim/claimName"},
+		{"Secret", "imagePullSecrets/*/name"},
+		{"ServiceAccount", "serviceAccountName"},
+	}
+	for _, c := range []string{"containers", "initContainers"} {
+		res = append(res,
+			refPattern{"ConfigMap", c + "/*/envFrom/*/configMapRef/name"},
+			refPattern{"ConfigMap", c + "/*/env/*/valueFrom/configMapKeyRef/name"},
+			refPattern{"Secret", c + "/*/envFrom/*/secretRef/name"},
+			refPattern{"Secret", c + "/*/env/*/valueFrom/secretKeyRef/name"},
+		)
+	}
+	return res
+}()
+
+var otherRefs = map[string][]refPattern{
+	"StatefulSet": {
+		{"Service", "spec/serviceName"},
+	},
+	"Ingress": {
+		{"Service", "spec/defaultBackend/service/name"},
+		{"Service", "spec/rules/*/http/paths/*/backend/service/name"},
+		{"Secret", "spec/tls/*/secretName"},
+	},
+}
+
+// A pathMatch is a node found by findPaths along with its concrete JSONPointer.
+type pathMatch struct {
+	ptr  string
+	node *yaml.Node
+}
+
+// findPaths returns all the scalar nodes matching a path pattern (see refPattern).
+func findPaths(root *yaml.Node, pattern string) []pathMatch {
+	if root.Kind == yaml.DocumentNode {
+		if len(root.Content) == 0 {
+			return nil
+		}
+		root = root.Content[0]
+	}
+	return findPathToks(root, strings.Split(pattern, "/"), "")
+}
+
+func findPathToks(n *yaml.Node, toks []string, prefix string) []pathMatch {
+	if len(toks) == 0 {
+		if n.Kind != yaml.ScalarNode {
+			return nil
+		}
+		return []pathMatch{{prefix, n}}
+	}
+
+	var res []pathMatch
+	switch tok := toks[0]; {
+	case n.Kind == yaml.SequenceNode && tok == "*":
+		for i, c := range n.Content {
+			res = append(res, findPathToks(c, toks[1:], fmt.Sprintf("%s/%d", prefix, i))...)
+		}
+	case n.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == tok {
+				res = append(res, findPathToks(n.Content[i+1], toks[1:], prefix+"/"+escapePointerToken(tok))...)
+			}
+		}
+	}
+	return res
+}
+
+func escapePointerToken(tok string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(tok, "~", "~0"), "/", "~1")
+}
+
+func unescapePointerToken(tok string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+}
+
+// nameReferences returns pointers to all the locations referencing by name a resource
+// of a given kind in a given namespace.
+func (ms Manifests) nameReferences(kind, namespace, name string) []pathPointer {
+	var res []pathPointer
+	for _, m := range ms {
+		if m.Metadata.Namespace != namespace {
+			continue
+		}
+		for _, r := range refPatterns(m.Kind) {
+			if r.kind != kind {
+				continue
+			}
+			for _, f := range findPaths(&m.raw, r.path) {
+				if f.node.Value == name {
+					res = append(res, pathPointer{Pointer{Expr: f.ptr, Manifest: m}, f.node})
+				}
+			}
+		}
+	}
+	return res
+}
+
+// labelReferences returns pointers to all the label selectors that select the pods of a given workload
+// by matching a given label.
+func (ms Manifests) labelReferences(workload *Manifest, key, value string) []pathPointer {
+	var res []pathPointer
+	for _, m := range ms {
+		if m.Metadata.Namespace != workload.Metadata.Namespace {
+			continue
+		}
+		prefix, ok := selectorPaths[m.Kind]
+		if !ok || (m.Kind != "Service" && m != workload) {
+			continue
+		}
+		for _, f := range findPaths(&m.raw, prefix+"/"+escapePointerToken(key)) {
+			if f.node.Value == value {
+				res = append(res, pathPointer{Pointer{Expr: f.ptr, Manifest: m}, f.node})
+			}
+		}
+	}
+	return res
+}
+
+// A pathPointer is a pointer along with the node it resolves to.
+type pathPointer struct {
+	Pointer
+	node *yaml.Node
+}
+
+// references returns pointers to all the locations that refer to the value old pointed by p,
+// as the field k allows (see Field.ResourceName and Field.PodLabel): all the references to a resource
+// name if p points to the name of the resource, or all the selectors matching a pod label
+// if p points to a pod template label.
+func (ms Manifests) references(k Field, p Pointer, old string) []pathPointer {
+	m := p.Manifest
+	if p.Expr == namePointer {
+		if !k.ResourceName {
+			return nil
+		}
+		return ms.nameReferences(m.Kind, m.Metadata.Namespace, old)
+	}
+	if prefix, ok := podTemplateMetadataPaths[m.Kind]; ok && k.PodLabel {
+		prefix = "/" + prefix + "/labels/"
+		if key := strings.TrimPrefix(p.Expr, prefix); key != p.Expr && !strings.Contains(key, "/") {
+			return ms.labelReferences(m, unescapePointerToken(key), old)
+		}
+	}
+	return nil
+}
+
+// resolveNode returns the YAML node pointed by a pointer, if the pointer doesn't traverse any lens.
+func (p Pointer) resolveNode() (*yaml.Node, bool) {
+	if strings.Contains(p.Expr, "/~(") {
+		return nil, false
+	}
+	n, err := yptr.Find(&p.Manifest.raw, p.Expr)
+	if err != nil {
+		return nil, false
+	}
+	return n, true
+}
+
+// A danglingReference is a reference to a resource that is not defined in the manifest set.
+type danglingReference struct {
+	Manifest *Manifest
+	Kind     string
+	Name     string
+	Ptr      string
+	Node     *yaml.Node
+}
+
+func (d danglingReference) String() string {
+	return fmt.Sprintf("%s references %s %q at %s, which is not defined in the manifest set",
+		d.Manifest.FQN().Short(), d.Kind, d.Name, d.Ptr)
+}
+
+// danglingReferences returns all the references to resources that are not defined in the manifest set.
+func (ms Manifests) danglingReferences() []danglingReference {
+	type key struct{ kind, namespace, name string }
+	defined := map[key]bool{}
+	for _, m := range ms {
+		defined[key{m.Kind, m.Metadata.Namespace, m.Metadata.Name}] = true
+	}
+
+	var res []danglingReference
+	for _, m := range ms {
+		for _, r := range refPatterns(m.Kind) {
+			for _, f := range findPaths(&m.raw, r.path) {
+				if r.kind == "ServiceAccount" && f.node.Value == "default" {
+					continue
+				}
+				if !defined[key{r.kind, m.Metadata.Namespace, f.node.Value}] {
+					res = append(res, danglingReference{Manifest: m, Kind: r.kind, Name: f.node.Value, Ptr: f.ptr, Node: f.node})
+				}
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"knot8.io/pkg/lensed"
+)
+
+func TestNameReferences(t *testing.T) {
+	src := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: demo
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        envFrom:
+        - configMapRef:
+            name: cfg
+      - name: sidecar
+        env:
+        - name: FOO
+          valueFrom:
+            configMapKeyRef:
+              name: cfg
+              key: foo
+      volumes:
+      - name: config
+        configMap:
+          name: other
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cfg
+`
+	ms, err := parseManifests(&shadowFile{name: "test.yaml", buf: []byte(src)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, r := range ms.nameReferences("ConfigMap", "", "cfg") {
+		got = append(got, r.Abs())
+	}
+	want := []string{
+		"~(yamls)/0/spec/template/spec/containers/0/envFrom/0/configMapRef/name",
+		"~(yamls)/0/spec/template/spec/containers/1/env/0/valueFrom/configMapKeyRef/name",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	if got, want := len(ms.danglingReferences()), 1; got != want {
+		t.Errorf("got: %d, want: %d", got, want)
+	}
+}
+
+func TestSetResourceName(t *testing.T) {
+	refs := []string{
+		"~(yamls)/0/spec/template/spec/containers/0/envFrom/0/configMapRef/name",
+		"~(yamls)/0/spec/template/spec/volumes/0/configMap/name",
+	}
+	testCases := []struct {
+		marked bool
+		want   string
+	}{
+		{true, "new-config"},
+		{false, "demo-config"},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			path := copyTestdata(t, "refs1.yaml")
+			ms, err := openFields([]string{path}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			k := ms.Fields["configName"]
+			if got, want := k.ResourceName, true; got != want {
+				t.Fatalf("got: %v, want: %v", got, want)
+			}
+			k.ResourceName = tc.marked
+			ms.Fields["configName"] = k
+
+			b := ms.NewEditBatch()
+			if err := b.Set("configName", "new-config"); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Commit(); err != nil {
+				t.Fatal(err)
+			}
+
+			buf := ms.Manifests[0].source.file.buf
+			got, err := lensed.Get(buf, append([]string{"~(yamls)/1/metadata/name"}, refs...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := string(got[0]), "new-config"; got != want {
+				t.Errorf("got: %q, want: %q", got, want)
+			}
+			for _, r := range got[1:] {
+				if got, want := string(r), tc.want; got != want {
+					t.Errorf("got: %q, want: %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSetPodLabel(t *testing.T) {
+	refs := []string{
+		"~(yamls)/0/spec/selector/matchLabels/app",
+		"~(yamls)/2/spec/selector/app",
+	}
+	testCases := []struct {
+		marked bool
+		want   string
+	}{
+		{true, "web"},
+		{false, "demo"},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			path := copyTestdata(t, "refs1.yaml")
+			ms, err := openFields([]string{path}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			k := ms.Fields["app"]
+			if got, want := k.PodLabel, true; got != want {
+				t.Fatalf("got: %v, want: %v", got, want)
+			}
+			k.PodLabel = tc.marked
+			ms.Fields["app"] = k
+
+			b := ms.NewEditBatch()
+			if err := b.Set("app", "web"); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Commit(); err != nil {
+				t.Fatal(err)
+			}
+
+			buf := ms.Manifests[0].source.file.buf
+			got, err := lensed.Get(buf, append([]string{"~(yamls)/0/spec/template/metadata/labels/app"}, refs...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := string(got[0]), "web"; got != want {
+				t.Errorf("got: %q, want: %q", got, want)
+			}
+			for _, r := range got[1:] {
+				if got, want := string(r), tc.want; got != want {
+					t.Errorf("got: %q, want: %q", got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+type RenameFieldCmd struct {
+	CommonFlags
+	CommonSchemaFlags
+	SecretsFlags
+
+	Old       string   `arg:"" help:"Current name of the field."`
+	New       string   `arg:"" help:"New name of the field."`
+	From      []string `name:"from" type:"existingfile" help:"Values files where to rename the field too."`
+	Deprecate bool     `name:"deprecate" help:"Keep accepting the old name, declaring it as a deprecated name of the field."`
+	Diff      bool     `name:"diff" help:"Show a unified diff of the changes instead of writing them."`
+}
+
+func (s *RenameFieldCmd) Run(ctx *Context) error {
+	manifestSet, err := openFields(s.Paths, s.Schema)
+	if err != nil && !isNotUniqueValueError(err) {
+		return err
+	}
+	manifestSet.showSecrets = s.ShowSecrets
+	if err := renameField(manifestSet, s.Old, s.New, s.Deprecate); err != nil {
+		return err
+	}
+	for _, p := range s.From {
+		if err := renameValuesKey(manifestSet, p, s.Old, s.New); err != nil {
+			return err
+		}
+	}
+
+	if s.Diff {
+		return manifestSet.Diff(os.Stdout)
+	}
+	return manifestSet.Commit()
+}
+
+// fieldAnnoPrefixes are the prefixes of the annotations keyed by a field name.
+var fieldAnnoPrefixes = []string{annoPrefix, sensitivePrefix, immutablePrefix, generatePrefix, resourceNamePrefix, podLabelPrefix}
+
+// renameField renames the field from as to in the annotations of the manifests and of the schema,
+// as well as in the original values. The files of the schema and of the original values stored
+// in sidecar files are scheduled to be written along with the manifests.
+// If deprecate is true, the old name is declared as a deprecated name of the field.
+func renameField(ms *ManifestSet, from, to string, deprecate bool) error {
+	if c, deprecated := ms.Fields.canonical(from); deprecated {
+		return fmt.Errorf("field %q is a deprecated name of %q", from, c)
+	} else if _, ok := ms.Fields[from]; !ok {
+		return fmt.Errorf("field %q not found", from)
+	}
+	if _, ok := ms.Fields[to]; ok {
+		return fmt.Errorf("field %q already exists", to)
+	}
+	if c, deprecated := ms.Fields.canonical(to); deprecated {
+		return fmt.Errorf("%q is a deprecated name of field %q", to, c)
+	}
+
+	var (
+		holder  *Manifest
+		changed = map[*shadowFile]bool{}
+	)
+	for _, m := range append(append(Manifests{}, ms.Manifests...), ms.schema...) {
+		f := m.source.file
+		annos, err := rawAnnotations(m)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range fieldAnnoPrefixes {
+			if _, ok := annos[p+from]; !ok {
+				continue
+			}
+			b, _, err := renameMapKey(f.buf, m.source.streamPos, "/metadata/annotations", p+from, p+to)
+			if err != nil {
+				return err
+			}
+			f.buf, changed[f] = b, true
+			if p == annoPrefix && holder == nil {
+				holder = m
+			}
+		}
+
+		set := func(k, v string) error {
+			b, err := setMapEntry(f.buf, m.source.streamPos, "/metadata/annotations", k, v)
+			if err != nil {
+				return err
+			}
+			f.buf, changed[f] = b, true
+			return nil
+		}
+		for k, v := range annos {
+			if strings.HasPrefix(k, deprecatedPrefix) && v == from {
+				if err := set(k, to); err != nil {
+					return err
+				}
+			}
+		}
+		if annos[enabledByAnno] == from {
+			if err := set(enabledByAnno, to); err != nil {
+				return err
+			}
+		}
+		if l := splitList(annos[generatedAnno]); slices.Contains(l, from) {
+			for i, n := range l {
+				if n == from {
+					l[i] = to
+				}
+			}
+			if err := set(generatedAnno, strings.Join(l, ",")); err != nil {
+				return err
+			}
+		}
+
+		if _, ok := annos[originalAnno]; ok {
+			if err := renameOriginal(ms, m, from, to); err != nil {
+				return err
+			}
+		}
+	}
+
+	if deprecate && holder != nil {
+		f := holder.source.file
+		b, err := setMapEntry(f.buf, holder.source.streamPos, "/metadata/annotations", deprecatedPrefix+from, to)
+		if err != nil {
+			return err
+		}
+		f.buf, changed[f] = b, true
+	}
+
+	// the schema file is not part of the manifests, write it along with the sidecar files.
+	for _, m := range ms.schema {
+		if f := m.source.file; changed[f] {
+			ms.addSidecar(f.name, f.buf)
+			break
+		}
+	}
+	return nil
+}
+
+// rawAnnotations returns the annotations of the manifest as found in its file, i.e.
+// without the annotations merged from the schema.
+func rawAnnotations(m *Manifest) (map[string]string, error) {
+	var r Manifest
+	if err := m.raw.Decode(&r); err != nil {
+		return nil, err
+	}
+	return r.Metadata.Annotations, nil
+}
+
+// renameOriginal renames the key from as to in the original values held by the
+// knot8.io/original annotation of m, retaining its storage form.
+func renameOriginal(ms *ManifestSet, m *Manifest, from, to string) error {
+	body, err := ms.decodeOriginalAnno(m)
+	if err != nil {
+		return err
+	}
+	b, ok, err := renameMapKey([]byte(body), 0, "", from, to)
+	if err != nil || !ok {
+		return err
+	}
+	anno := m.Metadata.Annotations[originalAnno]
+	v, err := ms.encodeOriginalAnno(m, b, baselineForm(anno))
+	if err != nil || v == anno {
+		return err
+	}
+	return setOriginalAnno(m, v)
+}
+
+// renameValuesKey renames the key from as to in the values file at path.
+// The file is scheduled to be written along with the manifests.
+func renameValuesKey(ms *ManifestSet, path, from, to string) error {
+	values, err := parseSimplifiedValues(path)
+	if err != nil {
+		return err
+	}
+	if _, ok := values[from]; !ok {
+		return nil
+	}
+	f, err := newShadowFile(path)
+	if err != nil {
+		return err
+	}
+	b, _, err := renameMapKey(f.buf, 0, "", from, to)
+	if err != nil {
+		return err
+	}
+	ms.addSidecar(path, b)
+	return nil
+}
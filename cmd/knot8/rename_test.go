@@ -0,0 +1,78 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"testing"
+)
+
+func TestRenameField(t *testing.T) {
+	ms := parseTestManifestSet(t, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/foo: /data/foo
+    field.knot8.io/on: /data/on
+    sensitive.knot8.io/foo: "false"
+    deprecated.knot8.io/oldfoo: foo
+    knot8.io/generated: foo,on
+    knot8.io/original: |
+      foo: x
+      on: "true"
+data:
+  foo: x
+  on: "true"
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: s
+  annotations:
+    knot8.io/enabled-by: foo
+`)
+	if err := renameField(ms, "foo", "bar", true); err != nil {
+		t.Fatal(err)
+	}
+	want := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/bar: /data/foo
+    field.knot8.io/on: /data/on
+    sensitive.knot8.io/bar: "false"
+    deprecated.knot8.io/oldfoo: bar
+    knot8.io/generated: bar,on
+    knot8.io/original: |
+      bar: x
+      on: "true"
+    deprecated.knot8.io/foo: bar
+data:
+  foo: x
+  on: "true"
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: s
+  annotations:
+    knot8.io/enabled-by: bar
+`
+	if got := string(ms.Manifests[0].source.file.buf); got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	ms = parseTestManifestSet(t, want)
+	for _, tc := range []struct{ from, to, err string }{
+		{"nope", "x", `field "nope" not found`},
+		{"foo", "x", `field "foo" is a deprecated name of "bar"`},
+		{"bar", "on", `field "on" already exists`},
+		{"on", "oldfoo", `"oldfoo" is a deprecated name of field "bar"`},
+	} {
+		if err := renameField(ms, tc.from, tc.to, false); err == nil || err.Error() != tc.err {
+			t.Errorf("got: %v, want: %q", err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+type ResetCmd struct {
+	CommonFlags
+	CommonSchemaFlags
+	CommonPolicyFlags
+	SecretsFlags
+
+	Fields []string `optional:"" arg:"" help:"Fields to restore."`
+	All    bool     `name:"all" help:"Restore all the fields."`
+	Stdout bool     `name:"stdout" help:"Output to stdout and never update files in-place"`
+	Diff   bool     `name:"diff" help:"Show a unified diff of the changes instead of writing them."`
+}
+
+func (s *ResetCmd) Run(ctx *Context) error {
+	if s.All == (len(s.Fields) > 0) {
+		return fmt.Errorf("either pass some fields or --all")
+	}
+
+	manifestSet, err := openFields(s.Paths, s.Schema)
+	if err != nil && !isNotUniqueValueError(err) {
+		return err
+	}
+	manifestSet.showSecrets = s.ShowSecrets
+	if s.Stdout {
+		for _, m := range manifestSet.Manifests {
+			m.source.file.name = "-"
+		}
+	}
+
+	names := s.Fields
+	if s.All {
+		names = manifestSet.Fields.Names()
+	}
+	for i, n := range names {
+		names[i] = canonicalName(manifestSet.Fields, n)
+	}
+
+	// like set, restoring the original value of an immutable field that has been changed is forbidden.
+	policy, err := s.CommonPolicyFlags.load()
+	if err != nil {
+		return err
+	}
+	batch := manifestSet.NewEditBatch()
+	if err := batch.Enforce(manifestSet, policy); err != nil {
+		return err
+	}
+	if err := resetFields(manifestSet, batch, names, s.All); err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+
+	if s.Diff {
+		return manifestSet.Diff(os.Stdout)
+	}
+	return manifestSet.Commit()
+}
+
+// resetFields adds to the batch the original values of the named fields.
+// Fields with no recorded original value are an error, unless lenient is true,
+// in which case they are reported as warnings.
+func resetFields(ms *ManifestSet, b EditBatch, names []string, lenient bool) error {
+	o, err := findOriginal(ms)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, n := range names {
+		k, err := ms.Fields.lookup(n)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		v, ok := o[k.Name]
+		if !ok {
+			if lenient {
+				fmt.Fprintf(os.Stderr, "warning: field %q has no recorded original value\n", k.Name)
+			} else {
+				errs = append(errs, fmt.Errorf("field %q has no recorded original value", k.Name))
+			}
+			continue
+		}
+		if cur, err := ms.Fields.GetValue(k.Name); err == nil && cur == v {
+			continue
+		}
+		if err := b.Set(k.Name, v); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if errs != nil {
+		return errors.Join(errs...)
+	}
+	return nil
+}
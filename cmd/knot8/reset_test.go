@@ -0,0 +1,71 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResetFields(t *testing.T) {
+	src := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/a: /data/a
+    field.knot8.io/b: /data/b
+    field.knot8.io/c: /data/c
+    knot8.io/original: |
+      a: "1"
+      b: "1"
+data:
+  a: "2"
+  b: "1"
+  c: "2"
+`
+	ms := parseTestManifestSet(t, src)
+	if err := resetFields(ms, ms.NewEditBatch(), []string{"a", "c"}, false); err == nil {
+		t.Errorf("expecting error for field with no original value")
+	}
+
+	b := ms.NewEditBatch()
+	if err := resetFields(ms, b, ms.Fields.Names(), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	for n, want := range map[string]string{"a": "1", "b": "1", "c": "2"} {
+		if got, err := ms.Fields.GetValue(n); err != nil {
+			t.Error(err)
+		} else if got != want {
+			t.Errorf("%s: got: %q, want: %q", n, got, want)
+		}
+	}
+}
+
+func TestResetImmutable(t *testing.T) {
+	src := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/a: /data/a
+    immutable.knot8.io/a: "true"
+    knot8.io/original: |
+      a: "1"
+data:
+  a: "2"
+`
+	path := filepath.Join(t.TempDir(), "test.yaml")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := ResetCmd{CommonFlags: CommonFlags{Paths: []string{path}}, Fields: []string{"a"}}
+	if err := s.Run(&Context{}); err == nil {
+		t.Errorf("expecting error for immutable field")
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// edit inlines or extracts the schema, see inlineSchema and extractSchema.
+func (s *SchemaCmd) edit() error {
+	if s.Inline && s.Schema == "" {
+		return fmt.Errorf("cannot find a schema file, use --schema")
+	}
+	path := s.Schema
+	if path == "" {
+		path = Knot8file
+	}
+
+	manifestSet, err := openFields(s.Paths, existingSchema(path))
+	if err != nil && !isNotUniqueValueError(err) {
+		return err
+	}
+	manifestSet.showSecrets = s.ShowSecrets
+
+	if s.Inline {
+		if err := inlineSchema(manifestSet); err != nil {
+			return err
+		}
+	} else {
+		f, err := newShadowFile(path)
+		if os.IsNotExist(err) {
+			f, err = &shadowFile{name: path, dir: filepath.Dir(path)}, nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := extractSchema(manifestSet, f); err != nil {
+			return err
+		}
+		manifestSet.addSidecar(f.name, f.buf)
+	}
+
+	if s.Diff {
+		return manifestSet.Diff(os.Stdout)
+	}
+	return manifestSet.Commit()
+}
+
+// isSchemaAnnotation returns true for the knot8 annotations describing the fields, as opposed
+// to the annotations holding the state of an instance, like the original values.
+func isSchemaAnnotation(a string) bool {
+	return isOurAnnotation(a) && a != originalAnno && a != generatedAnno
+}
+
+// inlineSchema persists in the manifests the annotations merged from the schema.
+// The comments describing the annotations in the schema are carried over.
+func inlineSchema(ms *ManifestSet) error {
+	for _, m := range ms.Manifests {
+		raw, err := rawAnnotations(m)
+		if err != nil {
+			return err
+		}
+		comments := map[string]string{}
+		for _, s := range ms.schema.Intersect(Manifests{m}) {
+			for k, c := range s.annotationComments() {
+				comments[k] = c
+			}
+		}
+
+		var keys []string
+		for k, v := range m.Metadata.Annotations {
+			if o, ok := raw[k]; isOurAnnotation(k) && (!ok || o != v) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		f := m.source.file
+		for _, k := range keys {
+			b, err := setMapEntry(f.buf, m.source.streamPos, "/metadata/annotations", k, m.Metadata.Annotations[k])
+			if err != nil {
+				return err
+			}
+			if c := comments[k]; c != "" {
+				if b, err = setLineComment(b, m.source.streamPos, "/metadata/annotations", k, c); err != nil {
+					return err
+				}
+			}
+			f.buf = b
+		}
+	}
+	return nil
+}
+
+// extractSchema moves the schema annotations (see isSchemaAnnotation) of the manifests to the schema file f,
+// along with the comments describing them. Inline annotations overridden by the schema are dropped.
+func extractSchema(ms *ManifestSet, f *shadowFile) error {
+	for _, m := range ms.Manifests {
+		n, ok := (Pointer{Expr: "/metadata/annotations", Manifest: m}).resolveNode()
+		if !ok || n.Kind != yaml.MappingNode {
+			continue
+		}
+		comments := m.annotationComments()
+
+		src := m.source.file
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i].Value, n.Content[i+1].Value
+			if !isSchemaAnnotation(k) {
+				continue
+			}
+			if m.Metadata.Annotations[k] != v {
+				fmt.Fprintf(os.Stderr, "warning: %s: dropping annotation %q, overridden by the schema\n", m.FQN().Short(), k)
+			} else if err := addSchemaAnno(f, m, k, v, comments[k]); err != nil {
+				return err
+			}
+			b, _, err := deleteMapEntry(src.buf, m.source.streamPos, "/metadata/annotations", k)
+			if err != nil {
+				return err
+			}
+			src.buf = b
+		}
+	}
+	return nil
+}
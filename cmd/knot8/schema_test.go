@@ -0,0 +1,104 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"testing"
+)
+
+const schemaTestSrc = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    # the foo
+    field.knot8.io/foo: /data/foo
+    knot8.io/original: |
+      foo: x
+data:
+  foo: x
+  bar: y
+`
+
+func TestExtractSchema(t *testing.T) {
+	ms := parseTestManifestSet(t, schemaTestSrc)
+	f := &shadowFile{name: "Knot8file", buf: []byte("foo: z\n")}
+	if err := extractSchema(ms, f); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    knot8.io/original: |
+      foo: x
+data:
+  foo: x
+  bar: y
+`
+	if got := string(ms.Manifests[0].source.file.buf); got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	want = `foo: z
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/foo: /data/foo # the foo
+`
+	if got := string(f.buf); got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestInlineSchema(t *testing.T) {
+	ms := parseTestManifestSet(t, schemaTestSrc)
+	schema, err := parseManifests(&shadowFile{name: "Knot8file", buf: []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    field.knot8.io/foo: /data/foo
+    # the bar
+    field.knot8.io/bar: /data/bar
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other
+  annotations:
+    field.knot8.io/baz: /data/baz
+`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms.schema = schema
+	ms.Manifests.MergeAnnotations(schema.Intersect(ms.Manifests))
+
+	if err := inlineSchema(ms); err != nil {
+		t.Fatal(err)
+	}
+	want := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+  annotations:
+    # the foo
+    field.knot8.io/foo: /data/foo
+    knot8.io/original: |
+      foo: x
+    field.knot8.io/bar: /data/bar # the bar
+data:
+  foo: x
+  bar: y
+`
+	if got := string(ms.Manifests[0].source.file.buf); got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
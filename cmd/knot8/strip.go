@@ -0,0 +1,30 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+// stripAnnotations removes the knot8 annotations (see isOurAnnotation) from the metadata of all
+// the documents of a YAML stream, along with the annotations map if that leaves it empty.
+// The annotations of the pod templates, like the knot8.io/checksum, are retained.
+func stripAnnotations(buf []byte) ([]byte, error) {
+	docs, err := parseYAMLDocs(buf)
+	if err != nil {
+		return nil, err
+	}
+	for pos := range docs {
+		var m Manifest
+		if err := docs[pos].Decode(&m); err != nil {
+			// not a resource
+			continue
+		}
+		for k := range m.Metadata.Annotations {
+			if !isOurAnnotation(k) {
+				continue
+			}
+			if buf, _, err = deleteMapEntry(buf, pos, "/metadata/annotations", k); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return buf, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestStripAnnotations(t *testing.T) {
+	testCases := []struct {
+		src  string
+		want string
+	}{
+		{
+			`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+  annotations:
+    field.knot8.io/foo: /data/foo
+    knot8.io/original: |
+      foo: x
+data:
+  foo: x
+`,
+			`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+data:
+  foo: x
+`,
+		},
+		{
+			`# leading comment
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: a
+  annotations:
+    other.io/keep: "true"
+    knot8.io/depends-on: ConfigMap/a
+spec:
+  template:
+    metadata:
+      annotations:
+        knot8.io/checksum: abc
+---
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: a, annotations: {field.knot8.io/foo: /data/foo}}
+`,
+			`# leading comment
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: a
+  annotations:
+    other.io/keep: "true"
+spec:
+  template:
+    metadata:
+      annotations:
+        knot8.io/checksum: abc
+---
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: a}
+`,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			got, err := stripAnnotations([]byte(tc.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := string(got), tc.want; got != want {
+				t.Errorf("got: %q, want: %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	diffContext = 3
+
+	// maxDiffCells bounds the size of the table used to compute the longest common subsequence.
+	// Larger changes are rendered as a single replaced block.
+	maxDiffCells = 4 << 20
+)
+
+// A diffOp is a line of a diff: ' ' (unchanged), '-' (removed) or '+' (added).
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// unifiedDiff returns the unified diff between a and b, or an empty string if they're equal.
+func unifiedDiff(fromName, toName string, a, b []byte) string {
+	return redactedDiff(fromName, toName, a, b, nil, nil)
+}
+
+// redactedDiff is like unifiedDiff, but the lines of a and b marked by ra and rb respectively
+// are redacted (see redactLine) in the output. The changes are computed on the original lines,
+// so that changed values are still reported.
+func redactedDiff(fromName, toName string, a, b []byte, ra, rb redactedLines) string {
+	if string(a) == string(b) {
+		return ""
+	}
+	ops := diffLines(splitLines(string(a)), splitLines(string(b)))
+	if ra != nil || rb != nil {
+		var i, j int
+		for k, op := range ops {
+			col, ok := ra[i]
+			if op.kind == '+' {
+				col, ok = rb[j]
+			} else if !ok && op.kind == ' ' {
+				col, ok = rb[j]
+			}
+			if ok {
+				ops[k].line = redactLine(op.line, col)
+			}
+			if op.kind != '+' {
+				i++
+			}
+			if op.kind != '-' {
+				j++
+			}
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+
+	for i := 0; i < len(ops); {
+		// find next change
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+		start := max(i-diffContext, 0)
+
+		// extend the hunk until there are more than 2*diffContext unchanged lines.
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			j := end
+			for j < len(ops) && ops[j].kind == ' ' {
+				j++
+			}
+			if j == len(ops) || j-end > 2*diffContext {
+				end = min(end+diffContext, len(ops))
+				break
+			}
+			end = j
+		}
+
+		aStart, bStart := 1, 1
+		for _, op := range ops[:start] {
+			if op.kind != '+' {
+				aStart++
+			}
+			if op.kind != '-' {
+				bStart++
+			}
+		}
+		var aLen, bLen int
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				aLen++
+			}
+			if op.kind != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		for _, op := range ops[start:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return sb.String()
+}
+
+func hunkRange(start, n int) string {
+	if n == 0 {
+		start--
+	}
+	if n == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, n)
+}
+
+// splitLines splits s in lines, retaining the line terminators.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes the edit script between a and b using the longest common subsequence of lines.
+func diffLines(a, b []string) []diffOp {
+	var prefix, suffix []diffOp
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, diffOp{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append([]diffOp{{' ', a[len(a)-1]}}, suffix...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	var middle []diffOp
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, l := range a {
+			middle = append(middle, diffOp{'-', l})
+		}
+		for _, l := range b {
+			middle = append(middle, diffOp{'+', l})
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(a) || j < len(b) {
+			switch {
+			case i < len(a) && j < len(b) && a[i] == b[j]:
+				middle = append(middle, diffOp{' ', a[i]})
+				i, j = i+1, j+1
+			case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+				middle = append(middle, diffOp{'+', b[j]})
+				j++
+			default:
+				middle = append(middle, diffOp{'-', a[i]})
+				i++
+			}
+		}
+	}
+
+	return append(append(prefix, middle...), suffix...)
+}
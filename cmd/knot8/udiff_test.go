@@ -0,0 +1,46 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	testCases := []struct {
+		a, b string
+		want string
+	}{
+		{"a\nb\n", "a\nb\n", ""},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			"1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			"--- a\n+++ b\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			"--- a\n+++ b\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -9,4 +9,3 @@\n 9\n 10\n 11\n-12\n",
+		},
+		{
+			"",
+			"a\n",
+			"--- a\n+++ b\n@@ -0,0 +1 @@\n+a\n",
+		},
+		{
+			"a\nb",
+			"a\nc",
+			"--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			if got := unifiedDiff("a", "b", []byte(tc.a), []byte(tc.b)); got != tc.want {
+				t.Errorf("got: %q, want: %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ module knot8.io
 go 1.24.0
 
 require (
+	filippo.io/age v1.2.1
 	github.com/alecthomas/kong v1.9.0
 	github.com/go-openapi/jsonpointer v0.22.1
 	github.com/google/go-jsonnet v0.21.0
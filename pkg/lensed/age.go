@@ -0,0 +1,124 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package lensed
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// AgeKeyFileEnv is the environment variable holding the path of the key file
+// used by an AgeLens with no explicit KeyFile.
+const AgeKeyFileEnv = "KNOT8_AGE_KEY_FILE"
+
+// AgeLens implements the "age" lens.
+// The field contains an ASCII armored age encrypted file. The lens decrypts it with the
+// identities found in a key file and re-encrypts the edited plaintext to the recipients
+// of those identities.
+type AgeLens struct {
+	// KeyFile is the path to a file containing one or more age identities.
+	// If empty, the path is taken from the KNOT8_AGE_KEY_FILE environment variable,
+	// falling back to knot8/age.key in the user configuration directory.
+	KeyFile string
+}
+
+func (a AgeLens) keyFile() (string, error) {
+	if a.KeyFile != "" {
+		return a.KeyFile, nil
+	}
+	if f := os.Getenv(AgeKeyFileEnv); f != "" {
+		return f, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "knot8", "age.key"), nil
+}
+
+func (a AgeLens) identities() ([]age.Identity, []age.Recipient, error) {
+	path, err := a.keyFile()
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("age key file: %w", err)
+	}
+	defer f.Close()
+
+	ids, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing age key file %q: %w", path, err)
+	}
+	var rs []age.Recipient
+	for _, id := range ids {
+		if x, ok := id.(*age.X25519Identity); ok {
+			rs = append(rs, x.Recipient())
+		}
+	}
+	if len(rs) == 0 {
+		return nil, nil, fmt.Errorf("no X25519 identities found in age key file %q", path)
+	}
+	return ids, rs, nil
+}
+
+// Apply implements the Lens interface.
+func (a AgeLens) Apply(src []byte, vals []Setter) ([]byte, error) {
+	ids, rs, err := a.identities()
+	if err != nil {
+		return nil, err
+	}
+
+	var plain []byte
+	if len(bytes.TrimSpace(src)) > 0 {
+		r, err := age.Decrypt(armor.NewReader(bytes.NewReader(src)), ids...)
+		if err != nil {
+			return nil, err
+		}
+		if plain, err = io.ReadAll(r); err != nil {
+			return nil, err
+		}
+	}
+
+	b := plain
+	for _, v := range vals {
+		if p := v.Pointer; p != "/" {
+			return nil, fmt.Errorf("age lens has no structure, invalid pointer %q", p)
+		}
+		var err error
+		b, err = v.Value.Transform(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// avoid re-encrypting unchanged values, since each encryption yields a different ciphertext.
+	if len(src) > 0 && bytes.Equal(b, plain) {
+		return src, nil
+	}
+
+	var buf bytes.Buffer
+	aw := armor.NewWriter(&buf)
+	w, err := age.Encrypt(aw, rs...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := aw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 VMware, Inc.
+// SPDX-License-Identifier: BSD-2-Clause
+
+package lensed
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestAge(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "age.key")
+	if err := os.WriteFile(keyFile, []byte(id.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	lm := LensMap{
+		"":    YAMLLens{},
+		"age": AgeLens{KeyFile: keyFile},
+	}
+
+	src := []byte("foo: \"\"\n")
+	enc, err := lm.Apply(src, []Mapping{{"/foo/~(age)", "s3cr3t"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(enc), "s3cr3t") {
+		t.Fatalf("plaintext leaked in %q", enc)
+	}
+
+	r, err := lm.Get(enc, []string{"/foo/~(age)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(r[0]), "s3cr3t"; got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	same, err := lm.Apply(enc, []Mapping{{"/foo/~(age)", "s3cr3t"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(same), string(enc); got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
@@ -21,6 +21,7 @@ var (
 		"ociImageRef": OCIImageRef{}, // deprecated
 		"oci":         OCIImageRef{},
 		"jsonnet":     Jsonnet{},
+		"age":         AgeLens{},
 	}
 )
 
@@ -82,8 +82,6 @@ func (MultiYAMLLens) Apply(src []byte, vals []Setter) ([]byte, error) {
 
 	b, _, err := transform.Bytes(yamled.T(ops...), src)
 	return b, err
-
-	return nil, fmt.Errorf("not implemented yet")
 }
 
 func parseAllYAMLDocs(src []byte) (res []*yaml.Node, err error) {